@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Hook defines the start/stop hook of a component managed by Lifecycle.
+//
+// Hooks are started in ascending order of Priority, and stopped in the reverse order,
+// so components that others depend on (e.g. redis, log writers) should use a lower priority
+// than the components depending on them (e.g. http/grpc services).
+type Hook struct {
+	// Name is the component name used in logs
+	Name string
+	// Priority decides the start/stop order of the hook
+	Priority int
+	// Timeout is the time budget of OnStart/OnStop, so that a slow hook does not use up the time
+	// of the others. It is capped by the time left on the ctx passed to Start/Stop. Zero means the
+	// default hook timeout of lifecycle, see SetHookTimeout.
+	Timeout time.Duration
+	// OnStart is called when the lifecycle starts, optional
+	OnStart func(ctx context.Context) error
+	// OnStop is called when the lifecycle stops, optional
+	OnStop func(ctx context.Context) error
+}
+
+// Lifecycle manages the ordered start/stop of application components
+type Lifecycle struct {
+	mu          sync.Mutex
+	hooks       []Hook
+	started     []Hook
+	ready       atomic.Bool
+	drainDelay  time.Duration
+	hookTimeout time.Duration
+	logger      *zap.Logger
+}
+
+// NewLifecycle create a new Lifecycle, if logger is nil, the global zap logger is used
+func NewLifecycle(logger *zap.Logger) *Lifecycle {
+	return &Lifecycle{
+		logger: logger,
+	}
+}
+
+// SetDrainDelay set the delay between failing readiness and stopping the hooks,
+// which gives load balancers the time to take the instance out of rotation.
+func (lc *Lifecycle) SetDrainDelay(d time.Duration) {
+	lc.mu.Lock()
+	lc.drainDelay = d
+	lc.mu.Unlock()
+}
+
+// SetHookTimeout set the default time budget of hooks without a Timeout,
+// zero means they are only limited by the ctx passed to Start/Stop.
+func (lc *Lifecycle) SetHookTimeout(d time.Duration) {
+	lc.mu.Lock()
+	lc.hookTimeout = d
+	lc.mu.Unlock()
+}
+
+// Append register a hook to the lifecycle, hooks with the same priority keep the register order
+func (lc *Lifecycle) Append(hook Hook) {
+	lc.mu.Lock()
+	lc.hooks = append(lc.hooks, hook)
+	lc.mu.Unlock()
+}
+
+// Ready return true if all hooks started and the lifecycle is not stopping
+func (lc *Lifecycle) Ready() bool {
+	return lc.ready.Load()
+}
+
+// ReadinessHandler return a http handler which responds 200 when ready, otherwise 503
+func (lc *Lifecycle) ReadinessHandler() http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		if !lc.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(status)
+		// nolint:errcheck
+		w.Write([]byte(http.StatusText(status)))
+	}
+	return http.HandlerFunc(f)
+}
+
+// Start run the OnStart of hooks in ascending priority order.
+// If any hook fails, the hooks already started are stopped in reverse order and the error is returned.
+func (lc *Lifecycle) Start(ctx context.Context) error {
+	lc.mu.Lock()
+	hooks := make([]Hook, len(lc.hooks))
+	copy(hooks, lc.hooks)
+	lc.mu.Unlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Priority < hooks[j].Priority
+	})
+
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			if err := lc.runHook(ctx, hook, "start", hook.OnStart); err != nil {
+				return multierr.Append(err, lc.stopHooks(ctx))
+			}
+		}
+
+		lc.mu.Lock()
+		lc.started = append(lc.started, hook)
+		lc.mu.Unlock()
+	}
+
+	lc.ready.Store(true)
+	lc.getLogger().Info("lifecycle started", zap.Int("hooks", len(hooks)))
+	return nil
+}
+
+// Stop fail the readiness, wait for the drain delay, then run the OnStop of started hooks in reverse order.
+// A hook exceeding its timeout is logged and skipped, so that a stuck component does not block the others.
+// ctx limits the whole stop, each hook gets its time budget or the time left on ctx, whichever is shorter.
+func (lc *Lifecycle) Stop(ctx context.Context) error {
+	lc.ready.Store(false)
+
+	lc.mu.Lock()
+	drainDelay := lc.drainDelay
+	lc.mu.Unlock()
+
+	logger := lc.getLogger()
+	logger.Info("lifecycle stopping", zap.Duration("drain_delay", drainDelay))
+
+	if drainDelay > 0 {
+		timer := time.NewTimer(drainDelay)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	err := lc.stopHooks(ctx)
+	logger.Info("lifecycle stopped", zap.Error(err))
+	return err
+}
+
+func (lc *Lifecycle) stopHooks(ctx context.Context) (err error) {
+	lc.mu.Lock()
+	started := lc.started
+	lc.started = nil
+	lc.mu.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop != nil {
+			err = multierr.Append(err, lc.runHook(ctx, hook, "stop", hook.OnStop))
+		}
+	}
+	return err
+}
+
+func (lc *Lifecycle) runHook(ctx context.Context, hook Hook, action string, f func(context.Context) error) error {
+	var (
+		logger = lc.getLogger().With(zap.String("hook", hook.Name), zap.String("action", action))
+		start  = time.Now()
+		done   = make(chan error, 1)
+		cancel context.CancelFunc
+	)
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		lc.mu.Lock()
+		timeout = lc.hookTimeout
+		lc.mu.Unlock()
+	}
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	result := func(err error) error {
+		if err != nil {
+			logger.Error("lifecycle hook failed", zap.Duration("duration", time.Since(start)), zap.Error(err))
+			return fmt.Errorf("%s %s: %w", action, hook.Name, err)
+		}
+		logger.Info("lifecycle hook done", zap.Duration("duration", time.Since(start)))
+		return nil
+	}
+
+	logger.Info("lifecycle hook running")
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- f(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return result(err)
+	case <-ctx.Done():
+		// prefer the result if the hook finished at the same time
+		select {
+		case err := <-done:
+			return result(err)
+		default:
+		}
+
+		logger.Error("lifecycle hook hung",
+			zap.Duration("duration", time.Since(start)),
+			zap.Duration("timeout", timeout),
+			zap.Error(ctx.Err()),
+		)
+		return fmt.Errorf("%s %s: %w", action, hook.Name, ctx.Err())
+	}
+}
+
+func (lc *Lifecycle) getLogger() *zap.Logger {
+	if lc.logger != nil {
+		return lc.logger
+	}
+	return zap.L().Named("lifecycle")
+}
+
+var defaultLifecycle = NewLifecycle(nil)
+
+// AppendHook register a hook to the default lifecycle
+func AppendHook(hook Hook) {
+	defaultLifecycle.Append(hook)
+}
+
+// SetDrainDelay set the drain delay of the default lifecycle
+func SetDrainDelay(d time.Duration) {
+	defaultLifecycle.SetDrainDelay(d)
+}
+
+// SetHookTimeout set the default hook timeout of the default lifecycle
+func SetHookTimeout(d time.Duration) {
+	defaultLifecycle.SetHookTimeout(d)
+}
+
+// Start start the default lifecycle
+func Start(ctx context.Context) error {
+	return defaultLifecycle.Start(ctx)
+}
+
+// Stop stop the default lifecycle
+func Stop(ctx context.Context) error {
+	return defaultLifecycle.Stop(ctx)
+}
+
+// Ready return the readiness of the default lifecycle
+func Ready() bool {
+	return defaultLifecycle.Ready()
+}
+
+// ReadinessHandler return the readiness http handler of the default lifecycle
+func ReadinessHandler() http.Handler {
+	return defaultLifecycle.ReadinessHandler()
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLifecycleOrder(t *testing.T) {
+	var (
+		lc    = NewLifecycle(zap.NewNop())
+		calls []string
+	)
+
+	hook := func(name string, priority int) Hook {
+		return Hook{
+			Name:     name,
+			Priority: priority,
+			OnStart: func(context.Context) error {
+				calls = append(calls, "start "+name)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	lc.Append(hook("http", 20))
+	lc.Append(hook("rdb", 10))
+	lc.Append(hook("grpc", 20))
+
+	require.False(t, lc.Ready())
+	require.NoError(t, lc.Start(context.Background()))
+	require.True(t, lc.Ready())
+	require.NoError(t, lc.Stop(context.Background()))
+	require.False(t, lc.Ready())
+
+	require.Equal(t, []string{
+		"start rdb", "start http", "start grpc",
+		"stop grpc", "stop http", "stop rdb",
+	}, calls)
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	var (
+		lc      = NewLifecycle(zap.NewNop())
+		stopped bool
+		errBoom = errors.New("boom")
+	)
+
+	lc.Append(Hook{
+		Name:     "first",
+		Priority: 1,
+		OnStop: func(context.Context) error {
+			stopped = true
+			return nil
+		},
+	})
+	lc.Append(Hook{
+		Name:     "second",
+		Priority: 2,
+		OnStart: func(context.Context) error {
+			return errBoom
+		},
+	})
+
+	err := lc.Start(context.Background())
+	require.True(t, errors.Is(err, errBoom))
+	require.True(t, stopped, "started hooks should be rolled back")
+	require.False(t, lc.Ready())
+}
+
+func TestLifecycleHookTimeout(t *testing.T) {
+	var (
+		lc       = NewLifecycle(zap.NewNop())
+		released = make(chan struct{})
+		stopped  bool
+	)
+	defer close(released)
+
+	lc.Append(Hook{
+		Name:     "quick",
+		Priority: 1,
+		OnStop: func(context.Context) error {
+			stopped = true
+			return nil
+		},
+	})
+	lc.Append(Hook{
+		Name:     "stuck",
+		Priority: 2,
+		Timeout:  10 * time.Millisecond,
+		OnStop: func(context.Context) error {
+			<-released
+			return nil
+		},
+	})
+
+	require.NoError(t, lc.Start(context.Background()))
+
+	err := lc.Stop(context.Background())
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.True(t, stopped, "hung hook should not block the others")
+}
+
+func TestLifecycleHookBudget(t *testing.T) {
+	var (
+		lc       = NewLifecycle(zap.NewNop())
+		released = make(chan struct{})
+		stopped  = make(chan error, 1)
+	)
+	defer close(released)
+
+	lc.SetHookTimeout(time.Second)
+	lc.Append(Hook{
+		Name:     "log",
+		Priority: 1,
+		OnStop: func(ctx context.Context) error {
+			stopped <- ctx.Err()
+			return nil
+		},
+	})
+	lc.Append(Hook{
+		Name:     "stuck",
+		Priority: 2,
+		OnStop: func(context.Context) error {
+			<-released
+			return nil
+		},
+	})
+
+	require.NoError(t, lc.Start(context.Background()))
+
+	// the stop ctx caps the hook budget, so the shutdown timeout limits the whole stop
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := lc.Stop(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	// the hooks after the deadline still run, but with an expired ctx
+	require.Equal(t, context.DeadlineExceeded, <-stopped)
+}
+
+func TestLifecycleReadinessHandler(t *testing.T) {
+	lc := NewLifecycle(zap.NewNop())
+	handler := lc.ReadinessHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	require.NoError(t, lc.Start(context.Background()))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,193 @@
+package kate
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const (
+	// HeaderContentEncoding the header name of `Content-Encoding`
+	HeaderContentEncoding = "Content-Encoding"
+	// MIMEApplicationForm the application type for url encoded form
+	MIMEApplicationForm = "application/x-www-form-urlencoded"
+)
+
+// ErrBodyTooLarge indicates the request body exceeds the size limit
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// bodyConfig defines how the request body is read
+type bodyConfig struct {
+	// maxBodyBytes limits the body size, after decompression if enabled, <= 0 means no limit
+	maxBodyBytes int64
+	// decompress enables decoding of `Content-Encoding: gzip/deflate/br`
+	decompress bool
+	// transcode enables transcoding the charset declared in `Content-Type` into utf-8
+	transcode bool
+}
+
+// readBody read the request body according to conf, the decoded body is returned,
+// and the `Content-Encoding`, `Content-Length` and `Content-Type` headers are updated to match it.
+func readBody(w http.ResponseWriter, r *http.Request, conf bodyConfig) (body []byte, err error) {
+	if conf.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, conf.maxBodyBytes)
+	}
+
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, err
+	}
+	// nolint:errcheck
+	r.Body.Close()
+
+	if conf.decompress {
+		if body, err = decompressBody(r, body, conf.maxBodyBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.transcode {
+		if body, err = transcodeBody(r, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
+
+func decompressBody(r *http.Request, body []byte, maxBodyBytes int64) ([]byte, error) {
+	var (
+		encoding = strings.ToLower(strings.TrimSpace(r.Header.Get(HeaderContentEncoding)))
+		reader   io.Reader
+		err      error
+	)
+
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		if reader, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return nil, fmt.Errorf("decode gzip body: %w", err)
+		}
+	case "deflate":
+		// `deflate` should be zlib wrapped, but some clients send the raw deflate stream
+		if reader, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			reader = flate.NewReader(bytes.NewReader(body))
+		}
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %v", encoding)
+	}
+
+	// limit the decompressed size to stop zip bombs
+	if maxBodyBytes > 0 {
+		reader = &limitReader{r: reader, n: maxBodyBytes}
+	}
+
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, fmt.Errorf("decode %v body: %w", encoding, err)
+	}
+
+	r.Header.Del(HeaderContentEncoding)
+	r.Header.Set(HeaderContentLength, strconv.Itoa(len(decoded)))
+	r.ContentLength = int64(len(decoded))
+	return decoded, nil
+}
+
+// limitReader reads at most n bytes from r, reading more fails with ErrBodyTooLarge,
+// even if r fails on the same read.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func transcodeBody(r *http.Request, body []byte) ([]byte, error) {
+	ctype := r.Header.Get(HeaderContentType)
+	if ctype == "" {
+		return body, nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return nil, fmt.Errorf("parse content type: %w", err)
+	}
+
+	charset := strings.ToLower(params["charset"])
+	if charset == "" || charset == "utf-8" || charset == "utf8" {
+		return body, nil
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset: %v", charset)
+	}
+	decoder := enc.NewDecoder()
+
+	if mediaType == MIMEApplicationForm {
+		// the values are percent-encoded, so transcode them after unescaping
+		var values url.Values
+		if values, err = url.ParseQuery(string(body)); err != nil {
+			return nil, fmt.Errorf("parse form body: %w", err)
+		}
+
+		utf8Values := make(url.Values, len(values))
+		for key, vals := range values {
+			var utf8Key string
+			if utf8Key, err = decoder.String(key); err != nil {
+				return nil, fmt.Errorf("transcode %v form body: %w", charset, err)
+			}
+			for _, val := range vals {
+				var utf8Val string
+				if utf8Val, err = decoder.String(val); err != nil {
+					return nil, fmt.Errorf("transcode %v form body: %w", charset, err)
+				}
+				utf8Values.Add(utf8Key, utf8Val)
+			}
+		}
+		body = []byte(utf8Values.Encode())
+	} else if body, err = decoder.Bytes(body); err != nil {
+		return nil, fmt.Errorf("transcode %v body: %w", charset, err)
+	}
+
+	params["charset"] = "utf-8"
+	r.Header.Set(HeaderContentType, mime.FormatMediaType(mediaType, params))
+	r.Header.Set(HeaderContentLength, strconv.Itoa(len(body)))
+	r.ContentLength = int64(len(body))
+	return body, nil
+}
@@ -0,0 +1,133 @@
+package kate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadBodyDecompress(t *testing.T) {
+	var (
+		data = []byte(`{"name":"zhangsan"}`)
+		conf = bodyConfig{maxBodyBytes: 1024, decompress: true}
+	)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(gzipBytes(t, data)))
+	r.Header.Set(HeaderContentEncoding, "gzip")
+
+	body, err := readBody(httptest.NewRecorder(), r, conf)
+	require.NoError(t, err)
+	require.Equal(t, data, body)
+	require.Empty(t, r.Header.Get(HeaderContentEncoding))
+	require.Equal(t, int64(len(data)), r.ContentLength)
+
+	var buf bytes.Buffer
+	bw := brotli.NewWriter(&buf)
+	_, err = bw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+
+	r = httptest.NewRequest(http.MethodPost, "/", &buf)
+	r.Header.Set(HeaderContentEncoding, "br")
+
+	body, err = readBody(httptest.NewRecorder(), r, conf)
+	require.NoError(t, err)
+	require.Equal(t, data, body)
+}
+
+func TestReadBodyZipBomb(t *testing.T) {
+	data := bytes.Repeat([]byte{'0'}, 1<<20)
+	compressed := gzipBytes(t, data)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+	r.Header.Set(HeaderContentEncoding, "gzip")
+
+	_, err := readBody(httptest.NewRecorder(), r, bodyConfig{
+		maxBodyBytes: int64(len(compressed)) * 2,
+		decompress:   true,
+	})
+	require.Equal(t, ErrBodyTooLarge, err)
+}
+
+func TestReadBodyCompressedTooLarge(t *testing.T) {
+	var (
+		data = bytes.Repeat([]byte{'0'}, 1<<20)
+		conf = bodyConfig{maxBodyBytes: 1024, decompress: true}
+	)
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	var bbuf bytes.Buffer
+	bw := brotli.NewWriter(&bbuf)
+	_, err = bw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+
+	// the gzip stream is cut off, so the decoder fails after passing the limit
+	truncated := gzipBytes(t, data)
+	truncated = truncated[:len(truncated)-4]
+
+	for encoding, compressed := range map[string][]byte{
+		"gzip":    truncated,
+		"deflate": zbuf.Bytes(),
+		"br":      bbuf.Bytes(),
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+		r.Header.Set(HeaderContentEncoding, encoding)
+
+		_, err = readBody(httptest.NewRecorder(), r, conf)
+		require.Equal(t, ErrBodyTooLarge, err, encoding)
+	}
+}
+
+func TestReadBodyTranscode(t *testing.T) {
+	encoder := simplifiedchinese.GBK.NewEncoder()
+	conf := bodyConfig{transcode: true}
+
+	gbkJSON, err := encoder.String(`{"name":"张三"}`)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(gbkJSON))
+	r.Header.Set(HeaderContentType, "application/json; charset=GBK")
+
+	body, err := readBody(httptest.NewRecorder(), r, conf)
+	require.NoError(t, err)
+	require.Equal(t, `{"name":"张三"}`, string(body))
+	require.Equal(t, "application/json; charset=utf-8", r.Header.Get(HeaderContentType))
+
+	gbkName, err := encoder.String("张三")
+	require.NoError(t, err)
+
+	form := url.Values{"name": {gbkName}}.Encode()
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+	r.Header.Set(HeaderContentType, MIMEApplicationForm+"; charset=gbk")
+
+	body, err = readBody(httptest.NewRecorder(), r, conf)
+	require.NoError(t, err)
+
+	values, err := url.ParseQuery(string(body))
+	require.NoError(t, err)
+	require.Equal(t, "张三", values.Get("name"))
+}
@@ -0,0 +1,188 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a manual clock for tests, the time only moves by Advance, and the timers, tickers
+// and sleeps fire when the time passes their deadline.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock  *Fake
+	until  time.Time
+	period time.Duration
+	ch     chan time.Time
+	f      func()
+}
+
+// NewFake create a fake clock starting at now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now return the time of fake clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since return the time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep block until the clock is advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After return a channel receiving the time after the clock is advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer create a timer firing after the clock is advanced by d
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, ch: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+// AfterFunc call fn in its own goroutine after the clock is advanced by d
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{clock: f, f: fn}
+	w.Reset(d)
+	return w
+}
+
+// NewTicker create a ticker firing every d, like time.Ticker the ticks are dropped for slow receivers
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	w := &fakeWaiter{clock: f, period: d, ch: make(chan time.Time, 1)}
+	w.Reset(d)
+	return fakeTicker{w}
+}
+
+// Advance move the clock forward by d, firing the timers and tickers in order of their deadlines
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	target := f.now.Add(d)
+	for {
+		w := f.earliest()
+		if w == nil || w.until.After(target) {
+			break
+		}
+
+		f.now = w.until
+		if w.period > 0 {
+			w.until = w.until.Add(w.period)
+		} else {
+			f.removeLocked(w)
+		}
+		w.fire(f.now)
+	}
+	f.now = target
+}
+
+// BlockUntil block until there are at least n timers, tickers and sleeps waiting on the clock,
+// so that an Advance after it is seen by them.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Waiters return the number of timers, tickers and sleeps waiting on the clock
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *Fake) earliest() *fakeWaiter {
+	var min *fakeWaiter
+	for _, w := range f.waiters {
+		if min == nil || w.until.Before(min.until) {
+			min = w
+		}
+	}
+	return min
+}
+
+func (f *Fake) removeLocked(w *fakeWaiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (w *fakeWaiter) fire(now time.Time) {
+	if w.f != nil {
+		go w.f()
+		return
+	}
+
+	select {
+	case w.ch <- now:
+	default:
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	f := w.clock
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.removeLocked(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	f := w.clock
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active := f.removeLocked(w)
+	w.until = f.now.Add(d)
+	if w.period == 0 && d <= 0 {
+		w.fire(f.now)
+		return active
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	return active
+}
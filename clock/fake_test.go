@@ -0,0 +1,56 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	timer := c.NewTimer(time.Second)
+	ticker := c.NewTicker(300 * time.Millisecond)
+	fired := make(chan struct{})
+	c.AfterFunc(500*time.Millisecond, func() { close(fired) })
+	require.Equal(t, 3, c.Waiters())
+
+	c.Advance(400 * time.Millisecond)
+	require.Equal(t, start.Add(400*time.Millisecond), c.Now())
+	require.Equal(t, start.Add(300*time.Millisecond), <-ticker.C())
+	select {
+	case <-timer.C():
+		t.Fatal("timer should not fire before its deadline")
+	default:
+	}
+
+	c.Advance(time.Second)
+	<-fired
+	require.Equal(t, start.Add(time.Second), <-timer.C())
+	// the ticks are dropped for the slow receiver
+	require.Equal(t, start.Add(600*time.Millisecond), <-ticker.C())
+	require.Equal(t, 1, c.Waiters())
+
+	require.False(t, timer.Stop())
+	require.False(t, timer.Reset(time.Second))
+	require.True(t, timer.Stop())
+	ticker.Stop()
+	require.Equal(t, 0, c.Waiters())
+}
+
+func TestFakeSleep(t *testing.T) {
+	c := NewFake(time.Now())
+
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	<-done
+	require.Equal(t, time.Minute, c.Since(c.Now().Add(-time.Minute)))
+}
@@ -26,6 +26,10 @@ func (h ContextHandlerFunc) ServeHTTP(ctx context.Context, w ResponseWriter, r *
 
 // Handle adapte the ContextHandler to httprouter.Handle func
 func Handle(ctx context.Context, h ContextHandler, maxBodyBytes int64) httprouter.Handle {
+	return handle(ctx, h, bodyConfig{maxBodyBytes: maxBodyBytes})
+}
+
+func handle(ctx context.Context, h ContextHandler, conf bodyConfig) httprouter.Handle {
 	f := func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		var (
 			request        *Request
@@ -47,22 +51,21 @@ func Handle(ctx context.Context, h ContextHandler, maxBodyBytes int64) httproute
 			wroteHeader:    false,
 		}
 
-		if maxBodyBytes > 0 {
-			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-		}
-
-		if request.RawBody, err = ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		if request.RawBody, err = readBody(w, r, conf); err != nil {
+			status := http.StatusBadRequest
+			if err == ErrBodyTooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.WriteHeader(status)
 			// nolint:errcheck
-			w.Write([]byte(http.StatusText(http.StatusBadRequest)))
+			w.Write([]byte(http.StatusText(status)))
+			logger.Warn("read request body", zap.Error(err))
 			return
 		}
-		// nolint:errcheck
-		r.Body.Close()
 
 		r.Body = ioutil.NopCloser(bytes.NewReader(request.RawBody))
 
-		err = r.ParseMultipartForm(maxBodyBytes)
+		err = r.ParseMultipartForm(conf.maxBodyBytes)
 		switch {
 		case err == http.ErrNotMultipart:
 		case err != nil:
@@ -80,6 +83,12 @@ func Handle(ctx context.Context, h ContextHandler, maxBodyBytes int64) httproute
 
 // StdHandler adapte ContextHandler to http.Handler interface
 func StdHandler(ctx context.Context, h ContextHandler, maxBodyBytes int64) http.Handler {
+	return stdHandler(ctx, h, bodyConfig{maxBodyBytes: maxBodyBytes}, nil)
+}
+
+// stdHandler adapte ContextHandler to http.Handler interface,
+// the path values of varNames are populated into Request.RestVars
+func stdHandler(ctx context.Context, h ContextHandler, conf bodyConfig, varNames []string) http.Handler {
 	f := func(w http.ResponseWriter, r *http.Request) {
 		var (
 			request        *Request
@@ -95,27 +104,36 @@ func StdHandler(ctx context.Context, h ContextHandler, maxBodyBytes int64) http.
 			Request: r,
 		}
 
+		if len(varNames) > 0 {
+			request.RestVars = make(httprouter.Params, 0, len(varNames))
+			for _, name := range varNames {
+				request.RestVars = append(request.RestVars, httprouter.Param{
+					Key:   name,
+					Value: r.PathValue(name),
+				})
+			}
+		}
+
 		response = &responseWriter{
 			ResponseWriter: w,
 			wroteHeader:    false,
 		}
 
-		if maxBodyBytes > 0 {
-			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-		}
-
-		if request.RawBody, err = ioutil.ReadAll(r.Body); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		if request.RawBody, err = readBody(w, r, conf); err != nil {
+			status := http.StatusBadRequest
+			if err == ErrBodyTooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.WriteHeader(status)
 			// nolint:errcheck
-			w.Write([]byte(http.StatusText(http.StatusBadRequest)))
+			w.Write([]byte(http.StatusText(status)))
+			logger.Warn("read request body", zap.Error(err))
 			return
 		}
-		// nolint:errcheck
-		r.Body.Close()
 
 		r.Body = ioutil.NopCloser(bytes.NewReader(request.RawBody))
 
-		err = r.ParseMultipartForm(maxBodyBytes)
+		err = r.ParseMultipartForm(conf.maxBodyBytes)
 		switch {
 		case err == http.ErrNotMultipart:
 		case err != nil:
@@ -2,23 +2,42 @@ package sampler
 
 import (
 	"time"
+
+	"github.com/k81/kate/clock"
 )
 
 type Sampler struct {
 	counter           counter
 	tick              time.Duration
 	first, thereafter uint64
+	clock             clock.Clock
+}
+
+// Option 配置Sampler
+type Option func(*Sampler)
+
+// WithClock 设置Sample使用的时钟，默认为真实时钟，测试中可使用clock.Fake
+func WithClock(c clock.Clock) Option {
+	return func(s *Sampler) {
+		s.clock = c
+	}
 }
 
 // 每tick间隔内:
 // 1. 对前first个请求返回true
 // 2. 之后开始采样，采样率为1/thereafter
-func New(tick time.Duration, first, thereafter int) *Sampler {
-	return &Sampler{
+func New(tick time.Duration, first, thereafter int, opts ...Option) *Sampler {
+	s := &Sampler{
 		tick:       tick,
 		first:      uint64(first),
 		thereafter: uint64(thereafter),
+		clock:      clock.New(),
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Sampler) Check(now time.Time) bool {
@@ -28,3 +47,8 @@ func (s *Sampler) Check(now time.Time) bool {
 	}
 	return true
 }
+
+// Sample 以Sampler时钟的当前时间调用Check
+func (s *Sampler) Sample() bool {
+	return s.Check(s.clock.Now())
+}
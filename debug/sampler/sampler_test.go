@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/k81/kate/clock"
 	"github.com/k81/kate/debug/sampler"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSamplerCheck(t *testing.T) {
@@ -27,3 +29,23 @@ func TestSamplerCheck(t *testing.T) {
 
 	t.Logf("count=%d", count)
 }
+
+func TestSamplerSample(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	s := sampler.New(time.Second, 2, 3, sampler.WithClock(c))
+
+	sample := func(n int) (count int) {
+		for i := 0; i < n; i++ {
+			if s.Sample() {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the first 2, then 1 of every 3
+	require.Equal(t, 2+3, sample(11))
+
+	c.Advance(time.Second)
+	require.Equal(t, 2, sample(2))
+}
@@ -1,4 +1,4 @@
-package httpsrv
+package kate
 
 // ErrorInfo defines the error type
 type ErrorInfo interface {
@@ -1,8 +1,9 @@
 module github.com/k81/kate
 
-go 1.12
+go 1.22
 
 require (
+	github.com/andybalholm/brotli v1.1.0
 	github.com/cloudflare/tableflip v1.0.0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/garyburd/redigo v1.6.0
@@ -17,16 +18,19 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd
 	github.com/modern-go/gls v0.0.0-20190610040709-84558782a674
 	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rogpeppe/fastuuid v1.1.0
 	github.com/sony/gobreaker v0.4.1
 	github.com/spf13/cobra v0.0.5
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.9.0
 	go.uber.org/atomic v1.5.1
-	go.uber.org/multierr v1.4.0 // indirect
+	go.uber.org/multierr v1.4.0
 	go.uber.org/zap v1.13.0
+	golang.org/x/text v0.14.0
 	golang.org/x/lint v0.0.0-20191125180803-fdd1cda4f05f // indirect
 	golang.org/x/tools v0.0.0-20191130070609-6e064ea0cf2d // indirect
 	google.golang.org/appengine v1.6.5 // indirect
 	google.golang.org/grpc v1.26.0
 	gopkg.in/ini.v1 v1.51.0
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,4 +1,4 @@
-package httpsrv
+package kate
 
 import (
 	"context"
@@ -9,6 +9,17 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// HeaderContentLength the header name of `Content-Length`
+	HeaderContentLength = "Content-Length"
+	// HeaderContentType the header name of `Content-Type`
+	HeaderContentType = "Content-Type"
+	// MIMEApplicationJSON the application type for json
+	MIMEApplicationJSON = "application/json"
+	// MIMEApplicationJSONCharsetUTF8 the application type for json of utf-8 encoding
+	MIMEApplicationJSONCharsetUTF8 = "application/json; charset=UTF-8"
+)
+
 // Error writes out an error response
 func Error(ctx context.Context, w http.ResponseWriter, err interface{}) {
 	errInfo, ok := err.(ErrorInfo)
@@ -0,0 +1,294 @@
+package kate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/k81/kate/debug/sampler"
+	"github.com/k81/kate/log/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// AccessLogFormatJSON logs the request as structured fields
+	AccessLogFormatJSON = "json"
+	// AccessLogFormatCombined logs the request as a line in Apache combined log format
+	AccessLogFormatCombined = "combined"
+
+	// RedactedValue is the value replacing the redacted header values and json fields
+	RedactedValue = "***"
+	// RedactedBody replaces the body which should be redacted but can not be parsed, e.g. truncated,
+	// or is not of a json/form content type
+	RedactedBody = "<unparseable body redacted>"
+
+	defaultAccessLogBodyBytes = 1024
+	combinedTimeLayout        = "02/Jan/2006:15:04:05 -0700"
+)
+
+// AccessLogConfig defines the config of the access log middleware
+type AccessLogConfig struct {
+	// Logger is the dedicated access logger, default is the logger in context
+	Logger *zap.Logger
+	// Format is AccessLogFormatJSON or AccessLogFormatCombined, default is AccessLogFormatJSON
+	Format string
+	// Headers are the request headers logged in json format
+	Headers []string
+	// RedactHeaders are the headers whose values are replaced with RedactedValue
+	RedactHeaders []string
+	// RedactJSONPaths are the dot separated paths of json/form body fields replaced with RedactedValue,
+	// `*` matches any object key or array element, e.g. `password`, `user.token`, `cards.*.number`
+	RedactJSONPaths []string
+	// MaxBodyBytes truncates the logged bodies, 0 means 1024, < 0 disables body logging
+	MaxBodyBytes int
+	// BodySampler samples the requests whose bodies are logged, nil means all
+	BodySampler *sampler.Sampler
+}
+
+type accessLog struct {
+	conf          AccessLogConfig
+	redactHeaders map[string]bool
+	redactPaths   [][]string
+}
+
+// NewAccessLog create an access log middleware.
+//
+// Bodies are only logged in json format, truncated to conf.MaxBodyBytes,
+// and omitted for binary content types.
+func NewAccessLog(conf AccessLogConfig) Middleware {
+	if conf.Format == "" {
+		conf.Format = AccessLogFormatJSON
+	}
+
+	if conf.MaxBodyBytes == 0 {
+		conf.MaxBodyBytes = defaultAccessLogBodyBytes
+	}
+
+	l := &accessLog{
+		conf:          conf,
+		redactHeaders: make(map[string]bool, len(conf.RedactHeaders)),
+	}
+
+	for _, name := range conf.RedactHeaders {
+		l.redactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+
+	for _, path := range conf.RedactJSONPaths {
+		l.redactPaths = append(l.redactPaths, strings.Split(path, "."))
+	}
+
+	return l.middleware
+}
+
+func (l *accessLog) middleware(h ContextHandler) ContextHandler {
+	f := func(ctx context.Context, w ResponseWriter, r *Request) {
+		start := time.Now()
+
+		h.ServeHTTP(ctx, w, r)
+
+		logger := l.conf.Logger
+		if logger == nil {
+			logger = ctxzap.Extract(ctx)
+		}
+
+		if l.conf.Format == AccessLogFormatCombined {
+			logger.Info(l.combinedLine(start, w, r))
+			return
+		}
+
+		logger.Info("access", l.jsonFields(start, w, r)...)
+	}
+	return ContextHandlerFunc(f)
+}
+
+func (l *accessLog) combinedLine(start time.Time, w ResponseWriter, r *Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	user := "-"
+	if r.URL.User != nil && r.URL.User.Username() != "" {
+		user = r.URL.User.Username()
+	}
+
+	size := "-"
+	if n := w.Size(); n > 0 {
+		size = fmt.Sprint(n)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q",
+		host,
+		user,
+		start.Format(combinedTimeLayout),
+		r.Method,
+		r.RequestURI,
+		r.Proto,
+		statusCode(w),
+		size,
+		r.Referer(),
+		r.UserAgent(),
+	)
+}
+
+func (l *accessLog) jsonFields(start time.Time, w ResponseWriter, r *Request) []zap.Field {
+	fields := []zap.Field{
+		zap.String("remote", r.RemoteAddr),
+		zap.String("method", r.Method),
+		zap.String("url", r.RequestURI),
+		zap.String("proto", r.Proto),
+		zap.Int("status_code", statusCode(w)),
+		zap.Int("req_size", len(r.RawBody)),
+		zap.Int("resp_size", w.Size()),
+		zap.Int64("duration_ms", int64(time.Since(start)/time.Millisecond)),
+	}
+
+	if len(l.conf.Headers) > 0 {
+		headers := make(map[string]string, len(l.conf.Headers))
+		for _, name := range l.conf.Headers {
+			name = http.CanonicalHeaderKey(name)
+			if value := r.Header.Get(name); value != "" {
+				if l.redactHeaders[name] {
+					value = RedactedValue
+				}
+				headers[name] = value
+			}
+		}
+		fields = append(fields, zap.Any("headers", headers))
+	}
+
+	if l.conf.MaxBodyBytes < 0 || (l.conf.BodySampler != nil && !l.conf.BodySampler.Check(start)) {
+		return fields
+	}
+
+	if body, ok := l.formatBody(r.Header.Get(HeaderContentType), r.RawBody); ok {
+		fields = append(fields, zap.String("req_body", body))
+	}
+
+	if body, ok := l.formatBody(w.Header().Get(HeaderContentType), w.RawBody()); ok {
+		fields = append(fields, zap.String("resp_body", body))
+	}
+	return fields
+}
+
+// formatBody redact and truncate the body, ok is false if the body is empty or binary
+func (l *accessLog) formatBody(ctype string, body []byte) (s string, ok bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if ctype != "" && (err != nil || !isTextMediaType(mediaType)) {
+		return "", false
+	}
+
+	if len(l.redactPaths) > 0 {
+		switch {
+		case mediaType == MIMEApplicationForm:
+			body = l.redactForm(body)
+		case mediaType == "", strings.HasSuffix(mediaType, "json"):
+			// the clients may send json without the content type
+			body = l.redactJSON(body)
+		default:
+			// no way to find the fields in the other formats
+			body = []byte(RedactedBody)
+		}
+	}
+
+	if len(body) > l.conf.MaxBodyBytes {
+		return fmt.Sprintf("%s...(%d bytes truncated)", body[:l.conf.MaxBodyBytes], len(body)-l.conf.MaxBodyBytes), true
+	}
+	return string(body), true
+}
+
+func (l *accessLog) redactJSON(body []byte) []byte {
+	var (
+		v   interface{}
+		dec = json.NewDecoder(bytes.NewReader(body))
+	)
+
+	// keep the numbers as is, e.g. int64 ids do not fit in float64
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		// not safe to log, it may contain the secrets
+		return []byte(RedactedBody)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return []byte(RedactedBody)
+	}
+
+	for _, path := range l.redactPaths {
+		v = redactValue(v, path)
+	}
+
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return []byte(RedactedBody)
+	}
+	return redacted
+}
+
+func (l *accessLog) redactForm(body []byte) []byte {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return []byte(RedactedBody)
+	}
+
+	for _, path := range l.redactPaths {
+		if len(path) == 1 {
+			if _, ok := values[path[0]]; ok {
+				values.Set(path[0], RedactedValue)
+			}
+		}
+	}
+	return []byte(values.Encode())
+}
+
+func redactValue(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return RedactedValue
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if path[0] == "*" || path[0] == key {
+				val[key] = redactValue(child, path[1:])
+			}
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for i := range val {
+				val[i] = redactValue(val[i], path[1:])
+			}
+		}
+	}
+	return v
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == MIMEApplicationForm,
+		mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+func statusCode(w ResponseWriter) int {
+	if code := w.StatusCode(); code != 0 {
+		return code
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,120 @@
+package kate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogJSON(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	mw := NewAccessLog(AccessLogConfig{
+		Logger:          zap.New(core),
+		Headers:         []string{"Authorization", "X-Request-Id"},
+		RedactHeaders:   []string{"authorization"},
+		RedactJSONPaths: []string{"password", "cards.*.number"},
+		MaxBodyBytes:    64,
+	})
+
+	h := mw(ContextHandlerFunc(func(_ context.Context, w ResponseWriter, _ *Request) {
+		w.Header().Set(HeaderContentType, "image/png")
+		// nolint:errcheck
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	}))
+
+	body := `{"name":"zhangsan","password":"123456","cards":[{"number":"6222"}]}`
+	w, _, r := newTestRequest()
+	r.Request = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	r.RawBody = []byte(body)
+	r.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-Request-Id", "abc")
+
+	h.ServeHTTP(context.Background(), w, r)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, int64(http.StatusOK), fields["status_code"])
+	require.Equal(t, map[string]string{"Authorization": RedactedValue, "X-Request-Id": "abc"}, fields["headers"])
+	require.Equal(t, `{"cards":[{"number":"***"}],"name":"zhangsan","password":"***"}`, fields["req_body"])
+	require.NotContains(t, fields, "resp_body", "binary body should be skipped")
+}
+
+func TestAccessLogRedactUnparseable(t *testing.T) {
+	l := &accessLog{conf: AccessLogConfig{MaxBodyBytes: 1024}, redactPaths: [][]string{{"password"}}}
+
+	s, ok := l.formatBody(MIMEApplicationJSON, []byte(`{"password":"123456","na`))
+	require.True(t, ok)
+	require.Equal(t, RedactedBody, s)
+
+	s, ok = l.formatBody(MIMEApplicationJSON, []byte(`{"id":1234567890123456789} {"password":"123456"}`))
+	require.True(t, ok)
+	require.Equal(t, RedactedBody, s)
+}
+
+func TestAccessLogRedactContentType(t *testing.T) {
+	l := &accessLog{conf: AccessLogConfig{MaxBodyBytes: 1024}, redactPaths: [][]string{{"password"}}}
+
+	s, ok := l.formatBody("", []byte(`{"id":1234567890123456789,"password":"123456"}`))
+	require.True(t, ok)
+	require.Equal(t, `{"id":1234567890123456789,"password":"***"}`, s)
+
+	s, ok = l.formatBody("", []byte(`password=123456`))
+	require.True(t, ok)
+	require.Equal(t, RedactedBody, s)
+
+	s, ok = l.formatBody("text/plain", []byte(`password=123456`))
+	require.True(t, ok)
+	require.Equal(t, RedactedBody, s)
+}
+
+func TestAccessLogSize(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	h := NewAccessLog(AccessLogConfig{
+		Logger: zap.New(core),
+	})(ContextHandlerFunc(func(_ context.Context, w ResponseWriter, _ *Request) {
+		// nolint:errcheck
+		w.Write([]byte("hello "))
+		// nolint:errcheck
+		w.Write([]byte("world"))
+	}))
+
+	w, _, r := newTestRequest()
+	h.ServeHTTP(context.Background(), w, r)
+
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, int64(11), logs.All()[0].ContextMap()["resp_size"])
+}
+
+func TestAccessLogTruncate(t *testing.T) {
+	l := &accessLog{conf: AccessLogConfig{MaxBodyBytes: 4}}
+	s, ok := l.formatBody("text/plain", []byte("hello world"))
+	require.True(t, ok)
+	require.Equal(t, "hell...(7 bytes truncated)", s)
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	h := NewAccessLog(AccessLogConfig{
+		Logger: zap.New(core),
+		Format: AccessLogFormatCombined,
+	})(ContextHandlerFunc(func(_ context.Context, w ResponseWriter, _ *Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	w, _, r := newTestRequest()
+	r.Header.Set("User-Agent", "curl/7.64")
+	h.ServeHTTP(context.Background(), w, r)
+
+	require.Equal(t, 1, logs.Len())
+	require.Regexp(t, `^192\.0\.2\.1 - - \[.+\] "GET / HTTP/1.1" 404 - "" "curl/7.64"$`, logs.All()[0].Message)
+}
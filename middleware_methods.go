@@ -6,10 +6,13 @@ import (
 	"strings"
 )
 
-// MethodOnly is a middleware to restrict http method for standard http router
+// MethodOnly is a middleware to restrict http method for standard http router.
+//
+// The Router registers method patterns instead, this is kept for handlers mounted elsewhere.
 func MethodOnly(method string, h ContextHandler) ContextHandler {
 	f := func(ctx context.Context, w ResponseWriter, r *Request) {
 		if strings.ToUpper(r.Method) != method {
+			w.Header().Set("Allow", method)
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			// nolint:errcheck
 			w.Write([]byte(http.StatusText(http.StatusMethodNotAllowed)))
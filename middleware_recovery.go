@@ -0,0 +1,93 @@
+package kate
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/k81/kate/log/ctxzap"
+	"github.com/k81/kate/utils"
+	"go.uber.org/zap"
+)
+
+// PanicHandler is called after a handler panic is recovered, typically used for alerting
+type PanicHandler func(ctx context.Context, r *Request, err interface{}, location string, stack string)
+
+// RecoveryConfig defines the config of the recovery middleware
+type RecoveryConfig struct {
+	// OnPanic is called after the panic is logged, optional
+	OnPanic PanicHandler
+	// Error is the error info written in the response, default is ErrServerInternal
+	Error ErrorInfo
+}
+
+// Recovery implements the recovery middleware with default config
+func Recovery(h ContextHandler) ContextHandler {
+	return NewRecovery(RecoveryConfig{})(h)
+}
+
+// NewRecovery create a recovery middleware.
+//
+// The panic is logged with its location and stack, and a Result envelope of conf.Error
+// is written with status 500 if the handler has not written the header yet.
+// The http.ErrAbortHandler panic is re-panicked to let net/http abort the response.
+func NewRecovery(conf RecoveryConfig) Middleware {
+	if conf.Error == nil {
+		conf.Error = ErrServerInternal
+	}
+
+	return func(h ContextHandler) ContextHandler {
+		f := func(ctx context.Context, w ResponseWriter, r *Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				var (
+					location = utils.LocatePanic()
+					stack    = utils.GetPanicStack()
+				)
+
+				ctxzap.Extract(ctx).Error("got panic",
+					zap.Any("error", err),
+					zap.String("location", location),
+					zap.String("stack", stack),
+				)
+
+				if conf.OnPanic != nil {
+					conf.OnPanic(ctx, r, err, location, stack)
+				}
+
+				if w.WroteHeader() {
+					return
+				}
+
+				writeRecoveryError(ctx, w, conf.Error)
+			}()
+
+			h.ServeHTTP(ctx, w, r)
+		}
+		return ContextHandlerFunc(f)
+	}
+}
+
+func writeRecoveryError(ctx context.Context, w ResponseWriter, errInfo ErrorInfo) {
+	b, err := EncodeJSON(&Result{
+		ErrNO:  errInfo.Code(),
+		ErrMsg: errInfo.Error(),
+	})
+	if err != nil {
+		ctxzap.Extract(ctx).Error("encode json response", zap.Error(err))
+		return
+	}
+
+	w.Header().Set(HeaderContentType, MIMEApplicationJSONCharsetUTF8)
+	w.WriteHeader(http.StatusInternalServerError)
+	if _, err = w.Write(b); err != nil {
+		ctxzap.Extract(ctx).Error("write json response", zap.Error(err))
+	}
+}
@@ -0,0 +1,68 @@
+package kate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequest() (*responseWriter, *httptest.ResponseRecorder, *Request) {
+	recorder := httptest.NewRecorder()
+	w := &responseWriter{ResponseWriter: recorder}
+	r := &Request{Request: httptest.NewRequest(http.MethodGet, "/", nil)}
+	return w, recorder, r
+}
+
+func TestRecovery(t *testing.T) {
+	var (
+		location string
+		panicked interface{}
+	)
+
+	mw := NewRecovery(RecoveryConfig{
+		OnPanic: func(_ context.Context, _ *Request, err interface{}, loc string, _ string) {
+			panicked = err
+			location = loc
+		},
+	})
+
+	h := mw(ContextHandlerFunc(func(context.Context, ResponseWriter, *Request) {
+		panic("boom")
+	}))
+
+	w, recorder, r := newTestRequest()
+	h.ServeHTTP(context.Background(), w, r)
+
+	require.Equal(t, "boom", panicked)
+	require.Contains(t, location, "TestRecovery")
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, MIMEApplicationJSONCharsetUTF8, recorder.Header().Get(HeaderContentType))
+	require.JSONEq(t, `{"errno":-1,"errmsg":"服务器内部错误"}`, recorder.Body.String())
+}
+
+func TestRecoveryHeaderWritten(t *testing.T) {
+	h := Recovery(ContextHandlerFunc(func(_ context.Context, w ResponseWriter, _ *Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+
+	w, recorder, r := newTestRequest()
+	h.ServeHTTP(context.Background(), w, r)
+
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	h := Recovery(ContextHandlerFunc(func(context.Context, ResponseWriter, *Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	w, _, r := newTestRequest()
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(context.Background(), w, r)
+	})
+}
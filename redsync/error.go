@@ -1,6 +1,103 @@
 package redsync
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
-// ErrFailed indicates error happened when acquire the lock
+// ErrFailed indicates error happened when acquire the lock. The lock failures are returned as an
+// *Error wrapping ErrFailed, so check them by errors.Is(err, ErrFailed) instead of err == ErrFailed.
 var ErrFailed = errors.New("redsync: failed to acquire lock")
+
+var (
+	// ErrTaken indicates the lock is held by another holder on too many nodes to reach the quorum.
+	// For Unlock and Extend, it means the lock is not held by this mutex any more.
+	ErrTaken = errors.New("redsync: lock taken by another holder")
+	// ErrUnreachable indicates none of the redis nodes could be reached
+	ErrUnreachable = errors.New("redsync: redis unreachable")
+	// ErrNoQuorum indicates the quorum is not reached for other reasons, e.g. some nodes are
+	// unreachable and some are taken, or the lock expired while acquiring it
+	ErrNoQuorum = errors.New("redsync: quorum not reached")
+	// ErrLost indicates the auto renewal of lock failed, and the lock may be held by others
+	ErrLost = errors.New("redsync: lock lost")
+)
+
+// Error reports a lock operation not reaching the quorum, errors.Is tells the reason by
+// ErrTaken, ErrUnreachable or ErrNoQuorum, and the failed lock attempts also match ErrFailed.
+type Error struct {
+	// Op is the operation, lock, unlock or extend
+	Op string
+	// Reason is ErrTaken, ErrUnreachable or ErrNoQuorum
+	Reason error
+	// OK, Taken and Unreachable are the number of nodes succeeded, held by others and failed with Err
+	OK, Taken, Unreachable int
+	// Quorum is the number of nodes required
+	Quorum int
+	// Err is the last error of unreachable nodes
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("redsync: %s failed: %v (ok %d, taken %d, unreachable %d, quorum %d)",
+		e.Op, e.Reason, e.OK, e.Taken, e.Unreachable, e.Quorum)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	errs := []error{e.Reason}
+	if e.Op == opLock {
+		errs = append(errs, ErrFailed)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+const (
+	opLock   = "lock"
+	opUnlock = "unlock"
+	opExtend = "extend"
+)
+
+// result counts the results of an operation on the nodes
+type result struct {
+	ok, taken, unreachable int
+	err                    error
+}
+
+func (r *result) add(ok bool, err error) {
+	switch {
+	case err != nil:
+		r.unreachable++
+		r.err = err
+	case ok:
+		r.ok++
+	default:
+		r.taken++
+	}
+}
+
+// error return the *Error of op not reaching the quorum
+func (r *result) error(op string, nodes, quorum int) error {
+	e := &Error{
+		Op:          op,
+		Reason:      ErrNoQuorum,
+		OK:          r.ok,
+		Taken:       r.taken,
+		Unreachable: r.unreachable,
+		Quorum:      quorum,
+		Err:         r.err,
+	}
+
+	switch {
+	case r.unreachable == nodes:
+		e.Reason = ErrUnreachable
+	case r.taken > nodes-quorum:
+		e.Reason = ErrTaken
+	}
+	return e
+}
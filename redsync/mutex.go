@@ -1,6 +1,7 @@
 package redsync
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/k81/kate/clock"
 	"github.com/k81/kate/utils"
 )
 
@@ -22,12 +24,16 @@ type Mutex struct {
 	delayMax time.Duration
 
 	factor float64
+	clock  clock.Clock
 
 	quorum int
 
 	token string
 	until time.Time
 
+	renewInterval time.Duration
+	watchdog      *watchdog
+
 	nodem sync.Mutex
 
 	pools []Pool
@@ -39,10 +45,53 @@ func (m *Mutex) GetToken() string {
 }
 
 // Lock locks m. In case it returns an error on failure, you may retry to acquire the lock by calling this method again.
+// The error of a failed lock is an *Error matching ErrFailed by errors.Is.
 func (m *Mutex) Lock() error {
+	return m.LockContext(context.Background())
+}
+
+// LockContext locks m like Lock, but gives up with ctx.Err() when ctx is done while retrying.
+// The error of a failed attempt is an *Error matching ErrFailed by errors.Is, and telling the reason
+// by ErrTaken, ErrUnreachable or ErrNoQuorum.
+func (m *Mutex) LockContext(ctx context.Context) error {
 	m.nodem.Lock()
 	defer m.nodem.Unlock()
 
+	if err := m.initToken(); err != nil {
+		return err
+	}
+
+	var err error
+	for i := 0; i < m.tries; i++ {
+		if i > 0 {
+			timer := m.clock.NewTimer(m.getDelay())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C():
+			}
+		}
+
+		if err = m.tryLock(ctx); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// TryLock tries to lock m once without retrying, the error of a failed attempt is like LockContext
+func (m *Mutex) TryLock() error {
+	m.nodem.Lock()
+	defer m.nodem.Unlock()
+
+	if err := m.initToken(); err != nil {
+		return err
+	}
+	return m.tryLock(context.Background())
+}
+
+func (m *Mutex) initToken() error {
 	if m.token == "" {
 		token, err := m.genToken()
 		if err != nil {
@@ -50,68 +99,99 @@ func (m *Mutex) Lock() error {
 		}
 		m.token = token
 	}
+	return nil
+}
 
-	for i := 0; i < m.tries; i++ {
-		start := time.Now()
+// tryLock make a lock attempt on the nodes, m.nodem must be held
+func (m *Mutex) tryLock(ctx context.Context) error {
+	start := m.clock.Now()
 
-		n := 0
-		for _, pool := range m.pools {
-			ok := m.acquire(pool, m.token)
-			if ok {
-				n++
-			}
+	var r result
+	for _, pool := range m.pools {
+		if err := ctx.Err(); err != nil {
+			m.releaseAll()
+			return err
 		}
+		r.add(m.acquire(pool, m.token))
+	}
 
-		until := time.Now().Add(m.expiry - time.Now().Sub(start) - time.Duration(int64(float64(m.expiry)*m.factor)) + 2*time.Millisecond)
-		if n >= m.quorum && time.Now().Before(until) {
-			m.until = until
-			return nil
+	now := m.clock.Now()
+	until := now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.factor)) + 2*time.Millisecond)
+	if r.ok >= m.quorum && now.Before(until) {
+		m.until = until
+		// keep the watchdog if locked again before unlock, unless the lock is lost
+		if m.renewInterval > 0 && (m.watchdog == nil || m.watchdog.ctx.Err() != nil) {
+			m.startWatchdog()
 		}
-		for _, pool := range m.pools {
-			m.release(pool, m.token)
-		}
-
-		time.Sleep(m.getDelay())
+		return nil
 	}
 
-	return ErrFailed
+	m.releaseAll()
+	return r.error(opLock, len(m.pools), m.quorum)
 }
 
 // Unlock unlocks m and returns the status of unlock. It is a run-time error if m is not locked on entry to Unlock.
 func (m *Mutex) Unlock() bool {
+	ok, _ := m.UnlockContext(context.Background())
+	return ok
+}
+
+// UnlockContext unlocks m like Unlock, an *Error is returned if the quorum is not reached,
+// or ctx.Err() if ctx is done before all the nodes are released. The auto renewal is stopped.
+func (m *Mutex) UnlockContext(ctx context.Context) (bool, error) {
+	m.stopWatchdog()
+
 	m.nodem.Lock()
 	defer m.nodem.Unlock()
 
-	n := 0
+	var r result
 	for _, pool := range m.pools {
-		ok := m.release(pool, m.token)
-		if ok {
-			n++
+		if err := ctx.Err(); err != nil {
+			return false, err
 		}
+		r.add(m.release(pool, m.token))
 	}
-	return n >= m.quorum
+
+	if r.ok >= m.quorum {
+		return true, nil
+	}
+	return false, r.error(opUnlock, len(m.pools), m.quorum)
 }
 
 // Extend resets the mutex's expiry and returns the status of expiry extension. It is a run-time error if m is not locked on entry to Extend.
 func (m *Mutex) Extend() bool {
+	ok, _ := m.ExtendContext(context.Background())
+	return ok
+}
+
+// ExtendContext extends m like Extend, an *Error is returned if the quorum is not reached,
+// or ctx.Err() if ctx is done before all the nodes are extended. The lock is released on failure.
+func (m *Mutex) ExtendContext(ctx context.Context) (bool, error) {
 	m.nodem.Lock()
 	defer m.nodem.Unlock()
 
-	n := 0
+	var r result
 	for _, pool := range m.pools {
-		ok := m.touch(pool, m.token, m.expiry)
-		if ok {
-			n++
+		if err := ctx.Err(); err != nil {
+			m.releaseAll()
+			return false, err
 		}
+		r.add(m.touch(pool, m.token, m.expiry))
 	}
-	if n >= m.quorum {
-		return true
+
+	if r.ok >= m.quorum {
+		return true, nil
 	}
 
+	m.releaseAll()
+	return false, r.error(opExtend, len(m.pools), m.quorum)
+}
+
+func (m *Mutex) releaseAll() {
 	for _, pool := range m.pools {
+		// nolint:errcheck
 		m.release(pool, m.token)
 	}
-	return false
 }
 
 func (m *Mutex) genToken() (string, error) {
@@ -131,11 +211,9 @@ func (m *Mutex) getDelay() time.Duration {
 	return time.Duration(n) + m.delayMin
 }
 
-func (m *Mutex) acquire(pool Pool, token string) bool {
+func (m *Mutex) acquire(pool Pool, token string) (bool, error) {
 	client := pool.Get()
-	// nolint:errcheck
-	ok, err := client.SetNX(m.name, token, m.expiry).Result()
-	return err == nil && ok
+	return client.SetNX(m.name, token, m.expiry).Result()
 }
 
 var deleteScript = redis.NewScript(`
@@ -146,11 +224,10 @@ var deleteScript = redis.NewScript(`
 	end
 `)
 
-func (m *Mutex) release(pool Pool, token string) bool {
+func (m *Mutex) release(pool Pool, token string) (bool, error) {
 	client := pool.Get()
-	// nolint:errcheck
 	result, err := deleteScript.Run(client, []string{m.name}, token).Int()
-	return err == nil && result == 1
+	return result == 1, err
 }
 
 var touchScript = redis.NewScript(`
@@ -166,9 +243,8 @@ var touchScript = redis.NewScript(`
 	end
 `)
 
-func (m *Mutex) touch(pool Pool, token string, expiry time.Duration) bool {
+func (m *Mutex) touch(pool Pool, token string, expiry time.Duration) (bool, error) {
 	client := pool.Get()
-	// nolint:errcheck
 	result, err := touchScript.Run(client, []string{m.name}, token, int(expiry/time.Millisecond)).Int()
-	return err == nil && result == 1
+	return result == 1, err
 }
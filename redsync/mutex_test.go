@@ -0,0 +1,162 @@
+package redsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k81/kate/clock"
+	"github.com/k81/kate/redsync/redsynctest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedsync(nodes ...*redsynctest.Node) *Redsync {
+	pools := make([]Pool, 0, len(nodes))
+	for _, node := range nodes {
+		pools = append(pools, node.Pool())
+	}
+	return New(pools)
+}
+
+func TestTryLock(t *testing.T) {
+	nodes := []*redsynctest.Node{redsynctest.NewNode(), redsynctest.NewNode(), redsynctest.NewNode()}
+	rs := newTestRedsync(nodes...)
+
+	a := rs.NewMutex("lock", SetToken("a"))
+	b := rs.NewMutex("lock", SetToken("b"))
+
+	require.NoError(t, a.TryLock())
+
+	err := b.TryLock()
+	require.ErrorIs(t, err, ErrTaken)
+	require.ErrorIs(t, err, ErrFailed)
+
+	var lockErr *Error
+	require.ErrorAs(t, err, &lockErr)
+	require.Equal(t, 3, lockErr.Taken)
+	require.Equal(t, 2, lockErr.Quorum)
+
+	ok, err := a.ExtendContext(context.Background())
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = b.UnlockContext(context.Background())
+	require.False(t, ok)
+	require.ErrorIs(t, err, ErrTaken)
+	require.NotErrorIs(t, err, ErrFailed)
+
+	require.True(t, a.Unlock())
+	require.NoError(t, b.TryLock())
+}
+
+func TestLockFailed(t *testing.T) {
+	rs := newTestRedsync(redsynctest.NewNode())
+	require.NoError(t, rs.NewMutex("lock", SetToken("a")).Lock())
+
+	// the callers checking ErrFailed keep working with errors.Is
+	err := rs.NewMutex("lock", SetToken("b"), SetTries(2), SetRetryDelay(time.Millisecond, 2*time.Millisecond)).Lock()
+	require.True(t, errors.Is(err, ErrFailed))
+	require.True(t, errors.Is(err, ErrTaken))
+}
+
+func TestLockErrors(t *testing.T) {
+	nodes := []*redsynctest.Node{redsynctest.NewNode(), redsynctest.NewNode(), redsynctest.NewNode()}
+	rs := newTestRedsync(nodes...)
+
+	// a minority of nodes down is tolerated
+	nodes[0].SetDown(true)
+	a := rs.NewMutex("lock", SetToken("a"))
+	require.NoError(t, a.TryLock())
+	require.True(t, a.Unlock())
+
+	// taken on one node and unreachable on another
+	nodes[1].SetValue("lock", "other")
+	err := a.TryLock()
+	require.ErrorIs(t, err, ErrNoQuorum)
+	require.ErrorIs(t, err, redsynctest.ErrDown)
+	require.Zero(t, nodes[2].Len(), "the partially acquired lock should be released")
+
+	for _, node := range nodes {
+		node.SetDown(true)
+	}
+	err = a.TryLock()
+	require.ErrorIs(t, err, ErrUnreachable)
+	require.ErrorIs(t, err, ErrFailed)
+}
+
+func TestLockContext(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	rs := newTestRedsync(redsynctest.NewNode())
+
+	require.NoError(t, rs.NewMutex("lock", SetToken("a")).TryLock())
+
+	m := rs.NewMutex("lock", SetToken("b"), SetClock(c), SetRetryDelay(time.Second, 2*time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- m.LockContext(ctx)
+	}()
+
+	// waiting for the retry delay
+	c.BlockUntil(1)
+	cancel()
+	require.Equal(t, context.Canceled, <-errs)
+
+	// the tries are exhausted
+	m = rs.NewMutex("lock", SetToken("b"), SetClock(c), SetTries(2), SetRetryDelay(time.Second, 2*time.Second))
+	go func() {
+		errs <- m.LockContext(context.Background())
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(2 * time.Second)
+	require.ErrorIs(t, <-errs, ErrTaken)
+}
+
+func TestAutoRenew(t *testing.T) {
+	var (
+		c    = clock.NewFake(time.Now())
+		node = redsynctest.NewNode()
+		rs   = newTestRedsync(node)
+		m    = rs.NewMutex("lock", SetToken("a"), SetClock(c), SetExpiry(3*time.Second), SetAutoRenew(0))
+	)
+
+	require.Nil(t, m.Lost())
+	require.NoError(t, m.TryLock())
+
+	lost, ctx := m.Lost(), m.Context()
+	require.NotNil(t, lost)
+
+	// renewed every second
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	c.Advance(time.Second)
+
+	node.SetValue("lock", "other")
+
+	c.Advance(time.Second)
+	<-lost
+	<-ctx.Done()
+
+	var lockErr *Error
+	require.ErrorIs(t, context.Cause(ctx), ErrLost)
+	require.ErrorAs(t, context.Cause(ctx), &lockErr)
+	require.Equal(t, opExtend, lockErr.Op)
+	require.ErrorIs(t, lockErr, ErrTaken)
+
+	// locked again after the loss, and the renewal stops on unlock
+	node.Delete("lock")
+
+	require.Eventually(t, func() bool { return c.Waiters() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, m.TryLock())
+	ctx = m.Context()
+	require.NoError(t, ctx.Err())
+	c.BlockUntil(1)
+
+	require.True(t, m.Unlock())
+	require.Equal(t, context.Canceled, context.Cause(ctx))
+	require.Equal(t, 0, c.Waiters())
+	require.Nil(t, m.Lost())
+}
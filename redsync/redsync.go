@@ -2,6 +2,8 @@ package redsync
 
 import (
 	"time"
+
+	"github.com/k81/kate/clock"
 )
 
 var (
@@ -29,12 +31,16 @@ func (r *Redsync) NewMutex(name string, options ...Option) *Mutex {
 		delayMin: 50 * time.Millisecond,
 		delayMax: 500 * time.Millisecond,
 		factor:   0.01,
+		clock:    clock.New(),
 		quorum:   len(r.pools)/2 + 1,
 		pools:    r.pools,
 	}
 	for _, o := range options {
 		o.Apply(m)
 	}
+	if m.renewInterval < 0 {
+		m.renewInterval = m.expiry / 3
+	}
 	return m
 }
 
@@ -85,6 +91,25 @@ func SetDriftFactor(factor float64) Option {
 	})
 }
 
+// SetClock set the clock used to measure the lock validity and to wait between retries.
+func SetClock(c clock.Clock) Option {
+	return OptionFunc(func(m *Mutex) {
+		m.clock = c
+	})
+}
+
+// SetAutoRenew enable the auto renewal of mutex, which extends the lock every interval in
+// background once locked, until it is unlocked or the extension fails, see Mutex.Lost.
+// interval <= 0 means a third of the expiry.
+func SetAutoRenew(interval time.Duration) Option {
+	return OptionFunc(func(m *Mutex) {
+		m.renewInterval = interval
+		if interval <= 0 {
+			m.renewInterval = -1
+		}
+	})
+}
+
 // SetToken set the mutex token
 func SetToken(token string) Option {
 	return OptionFunc(func(m *Mutex) {
@@ -0,0 +1,123 @@
+// Package redsynctest provides an in-memory redis node for testing the code using redsync locks.
+package redsynctest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrDown is returned by the commands of a node set down
+var ErrDown = errors.New("redsynctest: connection refused")
+
+// Node is an in-memory redis node supporting the commands used by redsync, the locks never expire
+type Node struct {
+	redis.Cmdable
+	mu     sync.Mutex
+	values map[string]string
+	down   bool
+}
+
+// NewNode create an empty node
+func NewNode() *Node {
+	return &Node{values: make(map[string]string)}
+}
+
+// Pool return a redsync.Pool of the node
+func (n *Node) Pool() Pool {
+	return Pool{node: n}
+}
+
+// SetDown make the commands fail with ErrDown if down is true, to simulate an unreachable node
+func (n *Node) SetDown(down bool) {
+	n.mu.Lock()
+	n.down = down
+	n.mu.Unlock()
+}
+
+// Value return the value of key
+func (n *Node) Value(key string) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	value, ok := n.values[key]
+	return value, ok
+}
+
+// SetValue set the value of key, e.g. to simulate a lock taken by others
+func (n *Node) SetValue(key, value string) {
+	n.mu.Lock()
+	n.values[key] = value
+	n.mu.Unlock()
+}
+
+// Delete delete key, e.g. to simulate an expired lock
+func (n *Node) Delete(key string) {
+	n.mu.Lock()
+	delete(n.values, key)
+	n.mu.Unlock()
+}
+
+// Len return the number of keys
+func (n *Node) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.values)
+}
+
+// SetNX implements redis.Cmdable
+func (n *Node) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.down {
+		return redis.NewBoolResult(false, ErrDown)
+	}
+	if _, ok := n.values[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	n.values[key] = fmt.Sprint(value)
+	return redis.NewBoolResult(true, nil)
+}
+
+// EvalSha implements redis.Cmdable, the scripts are never cached so that Eval is used
+func (n *Node) EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script"))
+}
+
+// Eval implements redis.Cmdable for the unlock and extend scripts of redsync
+func (n *Node) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.down {
+		return redis.NewCmdResult(nil, ErrDown)
+	}
+
+	value, ok := n.values[keys[0]]
+	switch {
+	case ok && value == fmt.Sprint(args[0]):
+		if strings.Contains(script, `"DEL"`) {
+			delete(n.values, keys[0])
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case !ok && strings.Contains(script, `"PEXPIRE"`):
+		n.values[keys[0]] = fmt.Sprint(args[0])
+		return redis.NewCmdResult(int64(1), nil)
+	}
+	return redis.NewCmdResult(int64(0), nil)
+}
+
+// Pool is a redsync.Pool always returning the node
+type Pool struct {
+	node *Node
+}
+
+// Get implements redsync.Pool
+func (p Pool) Get() redis.Cmdable {
+	return p.node
+}
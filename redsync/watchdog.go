@@ -0,0 +1,98 @@
+package redsync
+
+import (
+	"context"
+	"fmt"
+)
+
+// watchdog extends the lock in background, see SetAutoRenew
+type watchdog struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	lost   chan struct{}
+	done   chan struct{}
+}
+
+// Lost return a channel closed when the auto renewal fails, the holder should stop the work
+// guarded by the lock then, as the lock may be held by others. It is nil if the auto renewal
+// is not enabled or m is not locked.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.nodem.Lock()
+	defer m.nodem.Unlock()
+
+	if m.watchdog == nil {
+		return nil
+	}
+	return m.watchdog.lost
+}
+
+// Context return a context cancelled when the auto renewal fails with the cause wrapping ErrLost,
+// or when m is unlocked, so that the work guarded by the lock can be aborted by it.
+// It is nil if the auto renewal is not enabled or m is not locked.
+func (m *Mutex) Context() context.Context {
+	m.nodem.Lock()
+	defer m.nodem.Unlock()
+
+	if m.watchdog == nil {
+		return nil
+	}
+	return m.watchdog.ctx
+}
+
+// startWatchdog start the auto renewal, m.nodem must be held
+func (m *Mutex) startWatchdog() {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	w := &watchdog{
+		ctx:    ctx,
+		cancel: cancel,
+		lost:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	m.watchdog = w
+
+	go m.renew(w)
+}
+
+// stopWatchdog stop the auto renewal and wait for it to exit, m.nodem must not be held
+func (m *Mutex) stopWatchdog() {
+	m.nodem.Lock()
+	w := m.watchdog
+	m.watchdog = nil
+	m.nodem.Unlock()
+
+	if w == nil {
+		return
+	}
+
+	w.cancel(context.Canceled)
+	<-w.done
+}
+
+func (m *Mutex) renew(w *watchdog) {
+	defer close(w.done)
+
+	ticker := m.clock.NewTicker(m.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		ok, err := m.ExtendContext(w.ctx)
+		if ok {
+			continue
+		}
+		if w.ctx.Err() != nil {
+			// unlocked
+			return
+		}
+
+		w.cancel(fmt.Errorf("%w: %w", ErrLost, err))
+		close(w.lost)
+		return
+	}
+}
@@ -10,6 +10,7 @@ import (
 type Request struct {
 	*http.Request
 
+	// RestVars holds the path variables matched by RESTRouter or Router
 	RestVars httprouter.Params
 	RawBody  []byte
 }
@@ -11,6 +11,11 @@ type ResponseWriter interface {
 	StatusCode() int
 
 	RawBody() []byte
+
+	// Size return the total number of body bytes written, RawBody is only the last write
+	Size() int
+
+	WroteHeader() bool
 }
 
 type responseWriter struct {
@@ -19,6 +24,7 @@ type responseWriter struct {
 	wroteHeader bool
 	statusCode  int
 	rawBody     []byte
+	size        int
 }
 
 func (w *responseWriter) StatusCode() int {
@@ -29,6 +35,14 @@ func (w *responseWriter) RawBody() []byte {
 	return w.rawBody
 }
 
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) WroteHeader() bool {
+	return w.wroteHeader
+}
+
 func (w *responseWriter) WriteHeader(code int) {
 	if w.Header().Get("Content-Type") == "" {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -43,7 +57,9 @@ func (w *responseWriter) Write(b []byte) (int, error) {
 		w.WriteHeader(http.StatusOK)
 	}
 	w.rawBody = b
-	return w.ResponseWriter.Write(b)
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
 }
 
 func (w *responseWriter) Flush() {
@@ -11,8 +11,8 @@ import (
 // RESTRouter define the REST router
 type RESTRouter struct {
 	*httprouter.Router
-	maxBodyBytes int64
-	ctx          context.Context
+	body bodyConfig
+	ctx  context.Context
 }
 
 // NewRESTRouter create a REST router
@@ -28,12 +28,23 @@ func NewRESTRouter(ctx context.Context, logger *zap.Logger) *RESTRouter {
 
 // SetMaxBodyBytes set the body size limit
 func (r *RESTRouter) SetMaxBodyBytes(n int64) {
-	r.maxBodyBytes = n
+	r.body.maxBodyBytes = n
+}
+
+// SetDecompressBody enable decoding of the gzip/deflate/br `Content-Encoding` of request body,
+// the body size limit applies to the decompressed size
+func (r *RESTRouter) SetDecompressBody(enabled bool) {
+	r.body.decompress = enabled
+}
+
+// SetTranscodeBody enable transcoding of the request body in non utf-8 charset declared in `Content-Type`
+func (r *RESTRouter) SetTranscodeBody(enabled bool) {
+	r.body.transcode = enabled
 }
 
 // Handle register a http handler for the specified method and path
 func (r *RESTRouter) Handle(method, pattern string, h ContextHandler) {
-	r.Router.Handle(method, pattern, Handle(r.ctx, h, r.maxBodyBytes))
+	r.Router.Handle(method, pattern, handle(r.ctx, h, r.body))
 }
 
 // HandleFunc register a http handler for the specified method and path
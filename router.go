@@ -3,16 +3,23 @@ package kate
 import (
 	"context"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/k81/kate/log/ctxzap"
 	"go.uber.org/zap"
 )
 
-// Router defines the standard http outer
+var pathVarRegexp = regexp.MustCompile(`{([^{}]*)}`)
+
+// Router defines the standard http router.
+//
+// The patterns follow the syntax of http.ServeMux, e.g. `GET /items/{id}`,
+// the path values are populated into Request.RestVars.
 type Router struct {
 	*http.ServeMux
-	maxBodyBytes int64
-	ctx          context.Context
+	body bodyConfig
+	ctx  context.Context
 }
 
 // NewRouter create a http router
@@ -25,7 +32,18 @@ func NewRouter(ctx context.Context, logger *zap.Logger) *Router {
 
 // SetMaxBodyBytes set the body size limit
 func (r *Router) SetMaxBodyBytes(n int64) {
-	r.maxBodyBytes = n
+	r.body.maxBodyBytes = n
+}
+
+// SetDecompressBody enable decoding of the gzip/deflate/br `Content-Encoding` of request body,
+// the body size limit applies to the decompressed size
+func (r *Router) SetDecompressBody(enabled bool) {
+	r.body.decompress = enabled
+}
+
+// SetTranscodeBody enable transcoding of the request body in non utf-8 charset declared in `Content-Type`
+func (r *Router) SetTranscodeBody(enabled bool) {
+	r.body.transcode = enabled
 }
 
 // StdHandle register a standard http handler for the specified path
@@ -33,47 +51,67 @@ func (r *Router) StdHandle(pattern string, h http.Handler) {
 	r.ServeMux.Handle(pattern, h)
 }
 
-// Handle register a http handler for the specified path
+// Handle register a http handler for the specified pattern
 func (r *Router) Handle(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, h, r.maxBodyBytes))
+	r.ServeMux.Handle(pattern, stdHandler(r.ctx, h, r.body, pathVarNames(pattern)))
 }
 
-// HandleFunc register a http handler for the specified path
+// HandleFunc register a http handler for the specified pattern
 func (r *Router) HandleFunc(pattern string, h func(context.Context, ResponseWriter, *Request)) {
 	r.Handle(pattern, ContextHandlerFunc(h))
 }
 
+// HandleMethod register a http handler for the specified method and pattern,
+// a request of other methods to the pattern is responded with 405 and the `Allow` header.
+func (r *Router) HandleMethod(method, pattern string, h ContextHandler) {
+	r.Handle(method+" "+pattern, h)
+}
+
 // HEAD register a handler for HEAD request
 func (r *Router) HEAD(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, HEAD(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodHead, pattern, h)
 }
 
 // OPTIONS register a handler for OPTIONS request
 func (r *Router) OPTIONS(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, OPTIONS(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodOptions, pattern, h)
 }
 
-// GET register a handler for GET request
+// GET register a handler for GET request, which also matches HEAD request
 func (r *Router) GET(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, GET(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodGet, pattern, h)
 }
 
 // POST register a handler for POST request
 func (r *Router) POST(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, POST(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodPost, pattern, h)
 }
 
 // PUT register a handler for PUT request
 func (r *Router) PUT(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, PUT(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodPut, pattern, h)
 }
 
 // DELETE register a handler for DELETE request
 func (r *Router) DELETE(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, DELETE(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodDelete, pattern, h)
 }
 
 // PATCH register a handler for PATCH request
 func (r *Router) PATCH(pattern string, h ContextHandler) {
-	r.ServeMux.Handle(pattern, StdHandler(r.ctx, PATCH(h), r.maxBodyBytes))
+	r.HandleMethod(http.MethodPatch, pattern, h)
+}
+
+// pathVarNames return the wildcard names in the pattern, e.g. `id` and `path` for `/items/{id}/{path...}`
+func pathVarNames(pattern string) []string {
+	var names []string
+
+	for _, match := range pathVarRegexp.FindAllStringSubmatch(pattern, -1) {
+		name := strings.TrimSuffix(match[1], "...")
+		if name == "" || name == "$" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
 }
@@ -0,0 +1,53 @@
+package kate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPathVarNames(t *testing.T) {
+	require.Equal(t, []string{"id"}, pathVarNames("GET /items/{id}"))
+	require.Equal(t, []string{"id", "path"}, pathVarNames("/items/{id}/files/{path...}"))
+	require.Empty(t, pathVarNames("/items/{$}"))
+	require.Empty(t, pathVarNames("/items"))
+}
+
+func TestRouterMethods(t *testing.T) {
+	router := NewRouter(context.Background(), zap.NewNop())
+
+	handler := func(name string) ContextHandler {
+		return ContextHandlerFunc(func(_ context.Context, w ResponseWriter, r *Request) {
+			// nolint:errcheck
+			w.Write([]byte(name + ":" + r.RestVars.ByName("id")))
+		})
+	}
+
+	router.GET("/items/{id}", handler("get"))
+	router.POST("/items/{id}", handler("post"))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/items/10", nil))
+		return w
+	}
+
+	w := serve(http.MethodGet)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "get:10", w.Body.String())
+
+	w = serve(http.MethodPost)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "post:10", w.Body.String())
+
+	w = serve(http.MethodDelete)
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	require.ElementsMatch(t, []string{http.MethodGet, http.MethodHead, http.MethodPost}, allow)
+}
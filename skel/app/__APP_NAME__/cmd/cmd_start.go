@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -37,11 +38,6 @@ func startCmdFunc(_ *cobra.Command, _ []string) {
 	}
 
 	logger := initLogger()
-	defer func() {
-		if err := logger.Sync(); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "failed to flush log: %v", err)
-		}
-	}()
 
 	// update pid
 	if err := app.UpdatePIDFile(config.Main.PIDFile); err != nil {
@@ -66,9 +62,6 @@ func startCmdFunc(_ *cobra.Command, _ []string) {
 
 	logger.Info("server starting")
 
-	rdb.Init(config.Redis.Config)
-	defer rdb.Uninit()
-
 	// setup upgrader to support zero-downtime upgrade/restart
 	upgrader, err := tableflip.New(tableflip.Options{
 		PIDFile:        app.GetPidFile(),
@@ -79,15 +72,72 @@ func startCmdFunc(_ *cobra.Command, _ []string) {
 	}
 	defer upgrader.Stop()
 
-	grpcsrv.Start(upgrader, logger)
-	defer grpcsrv.Stop()
+	registerHooks(upgrader, logger)
 
-	httpsrv.Start(upgrader, logger)
-	defer httpsrv.Stop()
+	if err = app.Start(context.Background()); err != nil {
+		logger.Fatal("server start failed", zap.Error(err))
+	}
 
 	logger.Info("server started")
 
 	waitForShutdown(upgrader, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Main.ShutdownTimeout)
+	defer cancel()
+
+	if err = app.Stop(ctx); err != nil {
+		logger.Error("server stop failed", zap.Error(err))
+	}
+}
+
+// registerHooks register the start/stop hooks of components, lower priority starts first and stops last
+func registerHooks(upgrader *tableflip.Upgrader, logger *zap.Logger) {
+	app.SetDrainDelay(config.Main.DrainDelay)
+	app.SetHookTimeout(config.Main.HookTimeout)
+
+	app.AppendHook(app.Hook{
+		Name:     "log",
+		Priority: 0,
+		OnStop: func(context.Context) error {
+			if err := logger.Sync(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to flush log: %v", err)
+			}
+			return nil
+		},
+	})
+
+	app.AppendHook(app.Hook{
+		Name:     "rdb",
+		Priority: 10,
+		OnStart: func(context.Context) error {
+			rdb.Init(config.Redis.Config)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			rdb.Uninit()
+			return nil
+		},
+	})
+
+	app.AppendHook(app.Hook{
+		Name:     "grpcsrv",
+		Priority: 20,
+		OnStart: func(context.Context) error {
+			grpcsrv.Start(upgrader, logger)
+			return nil
+		},
+		OnStop: grpcsrv.Stop,
+	})
+
+	app.AppendHook(app.Hook{
+		Name:     "httpsrv",
+		Priority: 20,
+		OnStart: func(context.Context) error {
+			httpsrv.Start(upgrader, logger)
+			return nil
+		},
+		OnStop: httpsrv.Stop,
+	})
 }
 
 func waitForShutdown(upgrader *tableflip.Upgrader, logger *zap.Logger) {
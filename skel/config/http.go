@@ -16,8 +16,21 @@ type HTTPConfig struct {
 	WriteTimeout   time.Duration
 	MaxHeaderBytes int
 	MaxBodyBytes   int64
+	DecompressBody bool
+	TranscodeBody  bool
 	LogFile        string
 	LogSampler     LogSamplerConfig
+	AccessLog      AccessLogConfig
+}
+
+// AccessLogConfig defines the access log config
+type AccessLogConfig struct {
+	Format          string
+	Headers         []string
+	RedactHeaders   []string
+	RedactJSONPaths []string
+	MaxBodyBytes    int
+	BodySampler     LogSamplerConfig
 }
 
 // SectionName implements the `Config.SectionName()` method
@@ -32,10 +45,21 @@ func (conf *HTTPConfig) Load(section *ini.Section) error {
 	conf.WriteTimeout = section.Key("write_timeout").MustDuration(0)
 	conf.MaxHeaderBytes = section.Key("max_header_bytes").MustInt(1048576)
 	conf.MaxBodyBytes = section.Key("max_body_bytes").MustInt64(1073741824)
+	conf.DecompressBody = section.Key("decompress_body").MustBool(false)
+	conf.TranscodeBody = section.Key("transcode_body").MustBool(false)
 	conf.LogFile = section.Key("log_file").MustString("__APP_NAME__.access")
 	conf.LogSampler.Enabled = section.Key("log_sampler_enabled").MustBool(false)
 	conf.LogSampler.Tick = section.Key("log_sampler_tick").MustDuration(time.Second)
 	conf.LogSampler.First = section.Key("log_sampler_first").MustInt(100)
 	conf.LogSampler.ThereAfter = section.Key("log_sampler_thereafter").MustInt(10000)
+	conf.AccessLog.Format = section.Key("access_log_format").MustString("json")
+	conf.AccessLog.Headers = section.Key("access_log_headers").Strings(",")
+	conf.AccessLog.RedactHeaders = section.Key("access_log_redact_headers").Strings(",")
+	conf.AccessLog.RedactJSONPaths = section.Key("access_log_redact_json_paths").Strings(",")
+	conf.AccessLog.MaxBodyBytes = section.Key("access_log_max_body_bytes").MustInt(1024)
+	conf.AccessLog.BodySampler.Enabled = section.Key("access_log_body_sampler_enabled").MustBool(false)
+	conf.AccessLog.BodySampler.Tick = section.Key("access_log_body_sampler_tick").MustDuration(time.Second)
+	conf.AccessLog.BodySampler.First = section.Key("access_log_body_sampler_first").MustInt(100)
+	conf.AccessLog.BodySampler.ThereAfter = section.Key("access_log_body_sampler_thereafter").MustInt(100)
 	return nil
 }
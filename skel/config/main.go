@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"path"
+	"time"
 
 	"github.com/k81/kate/app"
 	"gopkg.in/ini.v1"
@@ -13,8 +14,11 @@ var Main = &MainConfig{}
 
 // MainConfig defines the Main config
 type MainConfig struct {
-	PIDFile string
-	LogDir  string
+	PIDFile         string
+	LogDir          string
+	ShutdownTimeout time.Duration
+	HookTimeout     time.Duration
+	DrainDelay      time.Duration
 }
 
 // SectionName implements the `Config.SectionName()` method
@@ -27,5 +31,8 @@ func (conf *MainConfig) Load(section *ini.Section) error {
 	defaultPIDFile := path.Join(app.GetHomeDir(), "run", fmt.Sprintf("%s.pid", app.GetName()))
 	conf.PIDFile = section.Key("pid_file").MustString(defaultPIDFile)
 	conf.LogDir = section.Key("log_dir").MustString("")
+	conf.ShutdownTimeout = section.Key("shutdown_timeout").MustDuration(30 * time.Second)
+	conf.HookTimeout = section.Key("hook_timeout").MustDuration(10 * time.Second)
+	conf.DrainDelay = section.Key("drain_delay").MustDuration(5 * time.Second)
 	return nil
 }
@@ -1,6 +1,7 @@
 package grpcsrv
 
 import (
+	"context"
 	"net"
 	"path"
 	"sync"
@@ -40,11 +41,12 @@ func Start(upgrader *tableflip.Upgrader, logger *zap.Logger) {
 	gService.start()
 }
 
-// Stop stop the grpc service
-func Stop() {
+// Stop stop the grpc service, waiting for the active rpcs until ctx is done
+func Stop(ctx context.Context) error {
 	if gService != nil {
-		gService.stop()
+		return gService.stop(ctx)
 	}
+	return nil
 }
 
 func (s *grpcService) start() {
@@ -99,7 +101,21 @@ func (s *grpcService) serve() {
 	}
 }
 
-func (s *grpcService) stop() {
-	s.server.GracefulStop()
-	s.wg.Wait()
+func (s *grpcService) stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		s.wg.Wait()
+		return nil
+	case <-ctx.Done():
+		s.logger.Error("grpc service graceful stop timeout, force stop", zap.Error(ctx.Err()))
+		s.server.Stop()
+		s.wg.Wait()
+		return ctx.Err()
+	}
 }
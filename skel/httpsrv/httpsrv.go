@@ -9,6 +9,8 @@ import (
 
 	"github.com/cloudflare/tableflip"
 	"github.com/k81/kate"
+	"github.com/k81/kate/app"
+	"github.com/k81/kate/debug/sampler"
 	"github.com/k81/kate/log"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -42,11 +44,12 @@ func Start(upgrader *tableflip.Upgrader, logger *zap.Logger) {
 	gService.start()
 }
 
-// Stop stop the http service
-func Stop() {
+// Stop stop the http service, waiting for the active requests until ctx is done
+func Stop(ctx context.Context) error {
 	if gService != nil {
-		gService.stop()
+		return gService.stop(ctx)
 	}
+	return nil
 }
 
 func (s *httpService) start() {
@@ -72,16 +75,36 @@ func (s *httpService) start() {
 
 	s.accessLogger = zap.New(core, opts...)
 
+	accessLogConf := kate.AccessLogConfig{
+		Logger:          s.accessLogger,
+		Format:          s.conf.AccessLog.Format,
+		Headers:         s.conf.AccessLog.Headers,
+		RedactHeaders:   s.conf.AccessLog.RedactHeaders,
+		RedactJSONPaths: s.conf.AccessLog.RedactJSONPaths,
+		MaxBodyBytes:    s.conf.AccessLog.MaxBodyBytes,
+	}
+
+	if s.conf.AccessLog.BodySampler.Enabled {
+		accessLogConf.BodySampler = sampler.New(
+			s.conf.AccessLog.BodySampler.Tick,
+			s.conf.AccessLog.BodySampler.First,
+			s.conf.AccessLog.BodySampler.ThereAfter,
+		)
+	}
+
 	// 定义中间件栈，可根据需要在下面追加
 	c := kate.NewChain(
-		Logging,
-		Recovery,
+		kate.NewAccessLog(accessLogConf),
+		kate.Recovery,
 	)
 
 	// 注册Handler
 	router := kate.NewRESTRouter(context.Background(), s.logger)
 	router.SetMaxBodyBytes(s.conf.MaxBodyBytes)
+	router.SetDecompressBody(s.conf.DecompressBody)
+	router.SetTranscodeBody(s.conf.TranscodeBody)
 	router.GET("/hello", c.Then(&HelloHandler{}))
+	router.Handler("GET", "/ready", app.ReadinessHandler())
 
 	// 生成一个http.Server对象
 	s.server = &http.Server{
@@ -111,14 +134,18 @@ func (s *httpService) serve() {
 
 	s.logger.Info("http service started listening", zap.String("addr", s.conf.Addr))
 
-	if err := s.server.Serve(s.listener); err != nil {
+	if err := s.server.Serve(s.listener); err != nil && err != http.ErrServerClosed {
 		s.logger.Fatal("failed to serve http service", zap.Error(err))
 	}
 }
 
-func (s *httpService) stop() {
-	if err := s.server.Shutdown(context.TODO()); err != nil {
+func (s *httpService) stop(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
 		s.logger.Error("http service shutdown failed", zap.Error(err))
+		// nolint:errcheck
+		s.server.Close()
+		return err
 	}
 	s.wg.Wait()
+	return nil
 }
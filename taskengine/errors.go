@@ -0,0 +1,36 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStopped indicates the task engine is already stopped
+	ErrStopped = errors.New("taskengine: engine stopped")
+	// ErrBusy indicates the task engine has no free concurrency to run the task right now
+	ErrBusy = errors.New("taskengine: engine busy")
+	// ErrQueueFull indicates the task queue of the engine is full
+	ErrQueueFull = errors.New("taskengine: queue full")
+	// ErrDropped indicates the task is dropped from the full queue by OverflowDropOldest
+	ErrDropped = errors.New("taskengine: task dropped")
+)
+
+// UnfinishedError is returned by Shutdown if the tasks do not finish before the deadline
+type UnfinishedError struct {
+	// Queued is the number of tasks not started yet
+	Queued int
+	// Running is the number of tasks still running
+	Running int
+	// Err is the error of the shutdown context
+	Err error
+}
+
+func (e *UnfinishedError) Error() string {
+	return fmt.Sprintf("taskengine: %d queued and %d running tasks unfinished: %v", e.Queued, e.Running, e.Err)
+}
+
+// Unwrap return the error of the shutdown context
+func (e *UnfinishedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,96 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+)
+
+// PanicError is the error of a future whose task panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("taskengine: task panic: %v", e.Value)
+}
+
+// Waiter is the untyped view of a Future, used by the group helpers
+type Waiter interface {
+	// Done return a channel closed when the task is finished
+	Done() <-chan struct{}
+	// Err return the task error, it should only be called after Done is closed
+	Err() error
+}
+
+// Future holds the result of a task submitted by Submit
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+func (f *Future[T]) complete(value T, err error) {
+	f.value = value
+	f.err = err
+	close(f.done)
+}
+
+// Done return a channel closed when the task is finished
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err return the task error, it should only be called after Done is closed
+func (f *Future[T]) Err() error {
+	return f.err
+}
+
+// Wait wait for the task result, or return ctx.Err() if ctx is done first
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit schedule f running on engine and return the future of its result.
+// A panic in f is converted to a *PanicError, and a scheduling failure completes the future with its error.
+// With WithRetry, the future completes after the last attempt.
+func Submit[T any](engine *TaskEngine, f func(ctx context.Context) (T, error), opts ...TaskOption) *Future[T] {
+	return SubmitCtx(context.Background(), engine, f, opts...)
+}
+
+// SubmitCtx is like Submit, but gives up scheduling when ctx is done, see TaskEngine.ScheduleCtx
+func SubmitCtx[T any](ctx context.Context, engine *TaskEngine, f func(ctx context.Context) (T, error), opts ...TaskOption) *Future[T] {
+	var (
+		future = newFuture[T]()
+		value  T
+	)
+
+	// a panic is converted to *PanicError by the Recover middleware of engine, if not replaced
+	task := ErrorTaskFunc(func(ctx context.Context) (err error) {
+		var zero T
+		value = zero
+		value, err = f(ctx)
+		return err
+	})
+
+	opts = append(opts, withDone(func(err error) {
+		future.complete(value, err)
+	}))
+
+	if err := engine.ScheduleCtx(ctx, task, opts...); err != nil {
+		var zero T
+		future.complete(zero, err)
+	}
+	return future
+}
@@ -0,0 +1,81 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFuture(t *testing.T) {
+	engine := New(context.Background(), "test", 2, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	future := Submit(engine, func(context.Context) (int, error) {
+		return 42, nil
+	})
+
+	value, err := future.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 42, value)
+
+	panicked := Submit(engine, func(context.Context) (int, error) {
+		panic("boom")
+	})
+
+	_, err = panicked.Wait(context.Background())
+	var panicErr *PanicError
+	require.True(t, errors.As(err, &panicErr))
+	require.Equal(t, "boom", panicErr.Value)
+}
+
+func TestWaitAllAndAny(t *testing.T) {
+	engine := New(context.Background(), "test", 0, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	var (
+		errBoom = errors.New("boom")
+		release = make(chan struct{})
+	)
+
+	slow := Submit(engine, func(context.Context) (string, error) {
+		<-release
+		return "slow", nil
+	})
+	fast := Submit(engine, func(context.Context) (int, error) {
+		return 0, errBoom
+	})
+
+	index, err := WaitAny(context.Background(), slow, fast)
+	require.Equal(t, 1, index)
+	require.Equal(t, errBoom, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, WaitAll(ctx, slow, fast))
+
+	close(release)
+	require.Equal(t, errBoom, WaitAll(context.Background(), slow, fast))
+}
+
+func TestGroup(t *testing.T) {
+	engine := New(context.Background(), "test", 0, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	errBoom := errors.New("boom")
+	g, ctx := NewGroup(context.Background(), engine)
+
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go(func(context.Context) error {
+		return errBoom
+	})
+
+	require.Equal(t, errBoom, g.Wait())
+	require.Error(t, ctx.Err(), "group context should be cancelled")
+}
@@ -0,0 +1,99 @@
+package taskengine
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// WaitAll wait for all the futures, and return the first error in order,
+// or ctx.Err() if ctx is done first
+func WaitAll(ctx context.Context, futures ...Waiter) error {
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, future := range futures {
+		if err := future.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitAny wait for the first finished future, and return its index and error,
+// or -1 and ctx.Err() if ctx is done first
+func WaitAny(ctx context.Context, futures ...Waiter) (int, error) {
+	cases := make([]reflect.SelectCase, 0, len(futures)+1)
+	for _, future := range futures {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(future.Done()),
+		})
+	}
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == len(futures) {
+		return -1, ctx.Err()
+	}
+	return chosen, futures[chosen].Err()
+}
+
+// Group runs a group of tasks on engine, the first error cancels the group context,
+// like golang.org/x/sync/errgroup
+type Group struct {
+	engine  *TaskEngine
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup create a group running tasks on engine, with a context derived from ctx
+func NewGroup(ctx context.Context, engine *TaskEngine) (*Group, context.Context) {
+	newctx, cancel := context.WithCancel(ctx)
+
+	g := &Group{
+		engine: engine,
+		ctx:    newctx,
+		cancel: cancel,
+	}
+	return g, newctx
+}
+
+// Go run f on engine with the group context, a scheduling failure is treated as an error of f
+func (g *Group) Go(f func(ctx context.Context) error, opts ...TaskOption) {
+	g.wg.Add(1)
+
+	future := SubmitCtx(g.ctx, g.engine, func(context.Context) (struct{}, error) {
+		return struct{}{}, f(g.ctx)
+	}, opts...)
+
+	go func() {
+		defer g.wg.Done()
+
+		<-future.Done()
+		if err := future.Err(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// Wait wait for all the tasks, and return the first error
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,120 @@
+package taskengine
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// serialQueue holds the tasks of a key waiting for the running one, it exists only while the key is busy
+type serialQueue struct {
+	key     string
+	pending []*taskItem
+}
+
+// ScheduleKeyed schedule a task running after all the tasks of the same key scheduled before it,
+// tasks of different keys run in parallel within the concurrency limit of engine.
+//
+// If no task of the key is running, it behaves like Schedule, otherwise the task is queued in
+// memory and it returns at once. A failed ErrorTask holds the key until its last attempt, and a
+// task dropped by OverflowDropOldest releases the key. In queue-backed mode, the next task of a key
+// waits for room if the queue is full, instead of overflowing it or being subject to the overflow policy.
+func (engine *TaskEngine) ScheduleKeyed(key string, task Task, opts ...TaskOption) error {
+	return engine.ScheduleKeyedCtx(context.Background(), key, task, opts...)
+}
+
+// ScheduleKeyedCtx is like ScheduleKeyed, but gives up with ctx.Err() when ctx is done, see ScheduleCtx
+func (engine *TaskEngine) ScheduleKeyedCtx(ctx context.Context, key string, task Task, opts ...TaskOption) error {
+	item := newTaskItem(task, opts)
+
+	engine.mu.Lock()
+
+	if engine.state != StateRunning {
+		engine.mu.Unlock()
+		engine.logger.Error("already stopped, should not schedule new task")
+		return ErrStopped
+	}
+
+	if sq, busy := engine.serial[key]; busy {
+		item.serial = sq
+		sq.pending = append(sq.pending, item)
+		engine.mu.Unlock()
+		return nil
+	}
+
+	if engine.serial == nil {
+		engine.serial = make(map[string]*serialQueue)
+	}
+	item.serial = &serialQueue{key: key}
+	engine.serial[key] = item.serial
+	engine.mu.Unlock()
+
+	if err := engine.scheduleItem(ctx, item); err != nil {
+		engine.mu.Lock()
+		engine.nextSerial(item, false)
+		engine.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// nextSerial start the next task of the key after item, or remove the idle key, engine.mu must be held.
+// ran is false if item failed to schedule.
+func (engine *TaskEngine) nextSerial(item *taskItem, ran bool) {
+	sq := item.serial
+
+	// once stopping, the pending tasks can only run if item ran on a worker or a tracked goroutine,
+	// otherwise the engine may be gone already
+	alive := ran && (item.dispatched || engine.sched.limit <= 0)
+	if engine.state != StateRunning && !alive {
+		if len(sq.pending) > 0 {
+			engine.logger.Warn("engine stopped, keyed tasks dropped", zap.String("key", sq.key), zap.Int("count", len(sq.pending)))
+		}
+		sq.pending = nil
+	}
+
+	if len(sq.pending) == 0 {
+		delete(engine.serial, sq.key)
+		return
+	}
+
+	if engine.sched.limit <= 0 {
+		engine.Add(1)
+		go engine.runUnlimited(sq.popPending())
+		return
+	}
+
+	if engine.queueMode && engine.sched.queued >= engine.sched.capacity {
+		engine.parked = append(engine.parked, sq)
+		return
+	}
+
+	engine.sched.push(sq.popPending())
+	engine.broadcast()
+}
+
+// unpark push the next tasks of the keys waiting for room while the queue is not full, engine.mu must be held
+func (engine *TaskEngine) unpark() {
+	for len(engine.parked) > 0 && engine.sched.queued < engine.sched.capacity {
+		sq := engine.parked[0]
+		engine.parked[0] = nil
+		engine.parked = engine.parked[1:]
+		engine.sched.push(sq.popPending())
+	}
+}
+
+func (sq *serialQueue) popPending() *taskItem {
+	next := sq.pending[0]
+	sq.pending[0] = nil
+	sq.pending = sq.pending[1:]
+	return next
+}
+
+// serialPending return the number of keyed tasks waiting in memory, engine.mu must be held
+func (engine *TaskEngine) serialPending() int {
+	n := 0
+	for _, sq := range engine.serial {
+		n += len(sq.pending)
+	}
+	return n
+}
@@ -0,0 +1,186 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestScheduleKeyed(t *testing.T) {
+	for _, level := range []int{0, 4} {
+		engine := New(context.Background(), "test", level, zap.NewNop())
+
+		var (
+			mu      sync.Mutex
+			orders  = make(map[string][]int)
+			running = make(map[string]*atomic.Int32)
+			overlap atomic.Bool
+		)
+
+		keys := []string{"a", "b", "c"}
+		for _, key := range keys {
+			running[key] = atomic.NewInt32(0)
+		}
+
+		for i := 0; i < 50; i++ {
+			for _, key := range keys {
+				key, i := key, i
+				require.NoError(t, engine.ScheduleKeyed(key, TaskFunc(func() {
+					if running[key].Inc() > 1 {
+						overlap.Store(true)
+					}
+					mu.Lock()
+					orders[key] = append(orders[key], i)
+					mu.Unlock()
+					running[key].Dec()
+				})))
+			}
+		}
+
+		require.NoError(t, engine.Shutdown(context.Background()))
+		require.False(t, overlap.Load(), "level %d", level)
+
+		for _, key := range keys {
+			require.Len(t, orders[key], 50)
+			for i, n := range orders[key] {
+				require.Equal(t, i, n, fmt.Sprintf("level %d key %s", level, key))
+			}
+		}
+		require.Empty(t, engine.serial)
+	}
+}
+
+func TestScheduleKeyedParallel(t *testing.T) {
+	engine := New(context.Background(), "test", 2, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	var (
+		started = make(chan struct{}, 2)
+		release = make(chan struct{})
+	)
+	for _, key := range []string{"a", "b"} {
+		require.NoError(t, engine.ScheduleKeyed(key, TaskFunc(func() {
+			started <- struct{}{}
+			<-release
+		})))
+	}
+	<-started
+	<-started
+	close(release)
+}
+
+func TestScheduleKeyedRetry(t *testing.T) {
+	engine := New(context.Background(), "test", 4, zap.NewNop())
+
+	var (
+		mu    sync.Mutex
+		calls []string
+		fails = 2
+	)
+	record := func(call string) {
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+	}
+
+	policy := RetryPolicy{InitialBackoff: 5 * time.Millisecond}
+	require.NoError(t, engine.ScheduleKeyed("a", ErrorTaskFunc(func(context.Context) error {
+		record("first")
+		if fails > 0 {
+			fails--
+			return errors.New("boom")
+		}
+		return nil
+	}), WithRetry(policy)))
+	second := make(chan struct{})
+	require.NoError(t, engine.ScheduleKeyed("a", TaskFunc(func() {
+		record("second")
+		close(second)
+	})))
+
+	<-second
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.Equal(t, []string{"first", "first", "first", "second"}, calls)
+	require.Empty(t, engine.serial)
+}
+
+func TestScheduleKeyedDropped(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithQueue(2, OverflowDropOldest))
+
+	var (
+		mu      sync.Mutex
+		ran     []string
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	record := func(name string) Task {
+		return TaskFunc(func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		})
+	}
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() {
+		close(started)
+		<-release
+	})))
+	<-started
+
+	require.NoError(t, engine.ScheduleKeyed("a", record("a1")))
+	for _, name := range []string{"a2", "a3", "a4"} {
+		require.NoError(t, engine.ScheduleKeyed("a", record(name)))
+	}
+	require.NoError(t, engine.Schedule(record("p1")))
+
+	// a1 is dropped and releases the key, but a2 waits for room instead of overflowing the queue,
+	// or being pushed and dropping the others in turn
+	require.NoError(t, engine.Schedule(record("p2")))
+	require.Equal(t, 2, engine.QueueLen())
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.Equal(t, []string{"p1", "p2", "a2", "a3", "a4"}, ran)
+	require.Empty(t, engine.serial)
+	require.Empty(t, engine.parked)
+}
+
+func TestScheduleKeyedQueueFull(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithQueue(1, OverflowReject))
+
+	var (
+		mu      sync.Mutex
+		ran     []string
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	record := func(name string) Task {
+		return TaskFunc(func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		})
+	}
+
+	require.NoError(t, engine.ScheduleKeyed("a", TaskFunc(func() {
+		close(started)
+		<-release
+	})))
+	<-started
+
+	require.NoError(t, engine.ScheduleKeyed("a", record("a2")))
+	require.NoError(t, engine.Schedule(record("p1")))
+
+	// a2 waits for room after the running task of the key, and runs after p1
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.Equal(t, []string{"p1", "a2"}, ran)
+	require.Empty(t, engine.serial)
+}
@@ -0,0 +1,90 @@
+package taskengine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AdaptiveLimit defines the AIMD adaptive concurrency limit.
+//
+// The limit grows by 1 per limit tasks succeeded while the engine is saturated,
+// and shrinks by Backoff when a task fails or its latency exceeds LatencyThreshold.
+type AdaptiveLimit struct {
+	// Min is the lower bound of the limit, must be > 0
+	Min int
+	// Max is the upper bound of the limit, also the number of workers
+	Max int
+	// LatencyThreshold is the latency treated as overload, 0 means latency is not considered
+	LatencyThreshold time.Duration
+	// Backoff is the multiplicative decrease factor in (0, 1), default 0.9
+	Backoff float64
+}
+
+// WithAdaptiveLimit let the engine adjust its concurrency between conf.Min and conf.Max
+// according to the task latency and errors, concurrencyLevel of New is the initial limit.
+// Only the failures of ErrorTask and panics are observed as errors.
+func WithAdaptiveLimit(conf AdaptiveLimit) Option {
+	if conf.Min <= 0 || conf.Max < conf.Min {
+		panic(fmt.Sprintf("invalid adaptive limit: min=%d max=%d", conf.Min, conf.Max))
+	}
+
+	if conf.Backoff <= 0 || conf.Backoff >= 1 {
+		conf.Backoff = 0.9
+	}
+
+	return func(engine *TaskEngine) {
+		engine.limiter = &limiter{conf: conf}
+	}
+}
+
+// limiter is the AIMD limit estimator, guarded by engine.mu
+type limiter struct {
+	conf     AdaptiveLimit
+	estimate float64
+}
+
+// init return the initial limit clamped into [Min, Max], concurrencyLevel <= 0 means Max
+func (l *limiter) init(concurrencyLevel int) int {
+	switch {
+	case concurrencyLevel <= 0 || concurrencyLevel > l.conf.Max:
+		concurrencyLevel = l.conf.Max
+	case concurrencyLevel < l.conf.Min:
+		concurrencyLevel = l.conf.Min
+	}
+
+	l.estimate = float64(concurrencyLevel)
+	return concurrencyLevel
+}
+
+// observe update the estimate with a finished task and return the new limit,
+// saturated is true if the task finished while the engine runs at its limit
+func (l *limiter) observe(latency time.Duration, failed, saturated bool) int {
+	switch {
+	case failed || (l.conf.LatencyThreshold > 0 && latency > l.conf.LatencyThreshold):
+		l.estimate = math.Max(float64(l.conf.Min), l.estimate*l.conf.Backoff)
+	case saturated:
+		l.estimate = math.Min(float64(l.conf.Max), l.estimate+1/l.estimate)
+	}
+	return int(l.estimate)
+}
+
+// adjustLimit feed the finished task to the limiter, engine.mu must be held
+func (engine *TaskEngine) adjustLimit(latency time.Duration, failed bool) {
+	old := engine.sched.limit
+
+	limit := engine.limiter.observe(latency, failed, engine.sched.running >= old)
+	if limit == old {
+		return
+	}
+
+	engine.sched.limit = limit
+	engine.logger.Info("concurrency limit changed",
+		zap.Int("old", old),
+		zap.Int("new", limit),
+		zap.Duration("latency", latency),
+		zap.Bool("failed", failed),
+	)
+}
@@ -0,0 +1,53 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLimiterObserve(t *testing.T) {
+	l := &limiter{conf: AdaptiveLimit{Min: 2, Max: 4, LatencyThreshold: time.Second, Backoff: 0.5}}
+	require.Equal(t, 4, l.init(0))
+	require.Equal(t, 2, l.init(1))
+	require.Equal(t, 3, l.init(3))
+
+	// additive increase only when saturated
+	require.Equal(t, 3, l.observe(time.Millisecond, false, false))
+	for i := 0; i < 3; i++ {
+		l.observe(time.Millisecond, false, true)
+	}
+	require.Equal(t, 4, l.observe(time.Millisecond, false, true))
+	require.Equal(t, 4, l.observe(time.Millisecond, false, true))
+
+	// multiplicative decrease on failure or high latency
+	require.Equal(t, 2, l.observe(time.Millisecond, true, true))
+	require.Equal(t, 2, l.observe(2*time.Second, false, true))
+}
+
+func TestEngineAdaptiveLimit(t *testing.T) {
+	engine := New(context.Background(), "test", 4, zap.NewNop(),
+		WithQueue(16, OverflowBlock),
+		WithAdaptiveLimit(AdaptiveLimit{Min: 1, Max: 8, Backoff: 0.5}),
+	)
+	defer engine.Shutdown(context.Background())
+	require.Equal(t, 4, engine.Limit())
+
+	errBoom := errors.New("boom")
+	for i := 0; i < 3; i++ {
+		_, err := Submit(engine, func(context.Context) (int, error) {
+			return 0, errBoom
+		}).Wait(context.Background())
+		require.Equal(t, errBoom, err)
+	}
+	require.Equal(t, 1, engine.Limit())
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, engine.Schedule(TaskFunc(func() {})))
+	}
+	require.Eventually(t, func() bool { return engine.Limit() > 1 }, time.Second, time.Millisecond)
+}
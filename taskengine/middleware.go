@@ -0,0 +1,90 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TaskHandler runs a task, the error is the one returned by ErrorTask, or nil for the other tasks
+type TaskHandler func(ctx context.Context, task Task) error
+
+// TaskMiddleware wraps a TaskHandler with cross-cutting behavior, e.g. logging, metrics, tracing
+// or context values, like kate.Middleware does for http handlers
+type TaskMiddleware func(next TaskHandler) TaskHandler
+
+// WithMiddleware append middlewares to the chain applied to every task of the engine.
+// The default chain is Recover alone, the first middleware appended is the outermost of the rest.
+func WithMiddleware(middlewares ...TaskMiddleware) Option {
+	return func(engine *TaskEngine) {
+		engine.middlewares = append(engine.middlewares, middlewares...)
+	}
+}
+
+// WithMiddlewareChain replace the whole chain including the default Recover, e.g. to put a tracing
+// middleware outside of Recover, or to use another recover middleware. The first middleware is the
+// outermost. A task panic is not recovered if the chain has no recover middleware.
+func WithMiddlewareChain(middlewares ...TaskMiddleware) Option {
+	return func(engine *TaskEngine) {
+		engine.middlewares = append([]TaskMiddleware(nil), middlewares...)
+	}
+}
+
+// Recover return a middleware converting a task panic into a *PanicError and logging it
+func Recover(logger *zap.Logger) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task Task) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("task panic:",
+						zap.Any("error", r),
+						zap.Stack("stack"),
+					)
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+
+			return next(ctx, task)
+		}
+	}
+}
+
+// Logging return a middleware logging the duration and error of every task, the panics are logged by Recover
+func Logging(logger *zap.Logger) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task Task) error {
+			start := time.Now()
+			err := next(ctx, task)
+
+			logger.Info("task done",
+				zap.String("task", fmt.Sprintf("%T", task)),
+				zap.Duration("duration", time.Since(start)),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+}
+
+// runTask is the innermost TaskHandler, calling the method implemented by task
+func runTask(ctx context.Context, task Task) error {
+	switch t := task.(type) {
+	case ErrorTask:
+		return t.RunError(ctx)
+	case ContextTask:
+		t.RunContext(ctx)
+	default:
+		t.Run()
+	}
+	return nil
+}
+
+func chainTask(middlewares []TaskMiddleware, h TaskHandler) TaskHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,89 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type ctxKey struct{}
+
+func TestMiddlewareChain(t *testing.T) {
+	var (
+		calls []string
+		trace = func(name string) TaskMiddleware {
+			return func(next TaskHandler) TaskHandler {
+				return func(ctx context.Context, task Task) error {
+					calls = append(calls, name)
+					return next(context.WithValue(ctx, ctxKey{}, name), task)
+				}
+			}
+		}
+	)
+
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithMiddleware(trace("outer"), trace("inner")))
+	defer engine.Shutdown(context.Background())
+
+	value, err := Submit(engine, func(ctx context.Context) (interface{}, error) {
+		return ctx.Value(ctxKey{}), nil
+	}).Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "inner", value)
+	require.Equal(t, []string{"outer", "inner"}, calls)
+}
+
+func TestDefaultRecover(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	engine := New(context.Background(), "test", 1, zap.New(core), WithMiddleware(Logging(zap.New(core))))
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() { panic("boom") })))
+	require.NoError(t, engine.Schedule(TaskFunc(func() {})))
+
+	_, err := Submit(engine, func(context.Context) (int, error) {
+		panic("boom")
+	}).Wait(context.Background())
+	var panicErr *PanicError
+	require.True(t, errors.As(err, &panicErr))
+
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.Equal(t, 2, logs.FilterMessage("task panic:").Len())
+	require.Equal(t, 1, logs.FilterMessage("task done").Len())
+}
+
+func TestMiddlewareChainReplace(t *testing.T) {
+	var (
+		calls   []string
+		errBoom = errors.New("boom")
+		// a recover middleware converting the panics into errBoom
+		recoverBoom = func(next TaskHandler) TaskHandler {
+			return func(ctx context.Context, task Task) (err error) {
+				defer func() {
+					if r := recover(); r != nil {
+						err = errBoom
+					}
+				}()
+				return next(ctx, task)
+			}
+		}
+		trace = func(next TaskHandler) TaskHandler {
+			return func(ctx context.Context, task Task) error {
+				err := next(ctx, task)
+				calls = append(calls, err.Error())
+				return err
+			}
+		}
+	)
+
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithMiddlewareChain(trace, recoverBoom))
+	defer engine.Shutdown(context.Background())
+
+	_, err := Submit(engine, func(context.Context) (int, error) {
+		panic("boom")
+	}).Wait(context.Background())
+	require.Equal(t, errBoom, err)
+	require.Equal(t, []string{"boom"}, calls, "the outer middleware should see the recovered error")
+}
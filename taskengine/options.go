@@ -0,0 +1,117 @@
+package taskengine
+
+import (
+	"fmt"
+
+	"github.com/k81/kate/clock"
+)
+
+// OverflowPolicy defines the behavior when scheduling a task to a full queue
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until the queue has free space
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the task with ErrQueueFull
+	OverflowReject
+	// OverflowDropOldest drops the oldest queued task to make room for the task,
+	// the dropped task finishes with ErrDropped, and is dead-lettered if it has a retry policy
+	OverflowDropOldest
+	// OverflowCallerRuns runs the task in the caller goroutine
+	OverflowCallerRuns
+)
+
+// String implements the fmt.Stringer interface
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowCallerRuns:
+		return "caller_runs"
+	}
+	return "unknown"
+}
+
+// Option configures a task engine
+type Option func(*TaskEngine)
+
+// WithQueue enable the queue-backed mode, in which a fixed pool of concurrencyLevel workers
+// run the tasks from a queue of capacity, and policy decides what happens when the queue is full.
+func WithQueue(capacity int, policy OverflowPolicy) Option {
+	if capacity <= 0 {
+		panic(fmt.Sprintf("invalid task queue capacity: %d", capacity))
+	}
+
+	return func(engine *TaskEngine) {
+		engine.queueMode = true
+		engine.sched.capacity = capacity
+		engine.overflowPolicy = policy
+	}
+}
+
+// WithPriorityReservation reserve n of the concurrency for tasks of priority p and higher,
+// so that lower priority tasks can not starve them
+func WithPriorityReservation(p Priority, n int) Option {
+	return func(engine *TaskEngine) {
+		engine.sched.reserved[validPriority(p)] = n
+	}
+}
+
+// WithKeyWeights set the weights of fair keys in the weighted round-robin, default weight is 1
+func WithKeyWeights(weights map[string]int) Option {
+	return func(engine *TaskEngine) {
+		engine.sched.weights = weights
+	}
+}
+
+// TaskOption configures a scheduled task
+type TaskOption func(*taskItem)
+
+// WithPriority set the priority of task, default is PriorityNormal
+func WithPriority(p Priority) TaskOption {
+	return func(item *taskItem) {
+		item.priority = validPriority(p)
+	}
+}
+
+// WithFairKey set the fair key of task, e.g. tenant id, tasks of the same priority are
+// dispatched in weighted round-robin between keys
+func WithFairKey(key string) TaskOption {
+	return func(item *taskItem) {
+		item.key = key
+	}
+}
+
+func newTaskItem(task Task, opts []TaskOption) *taskItem {
+	item := &taskItem{
+		task:     task,
+		priority: PriorityNormal,
+	}
+
+	for _, opt := range opts {
+		opt(item)
+	}
+	return item
+}
+
+func validPriority(p Priority) Priority {
+	switch {
+	case p < PriorityLow:
+		return PriorityLow
+	case p > PriorityHigh:
+		return PriorityHigh
+	}
+	return p
+}
+
+// WithClock set the clock of task engine used by the retry backoff and the latency measurement
+// of adaptive limit, default is the real clock, e.g. a clock.Fake in tests
+func WithClock(c clock.Clock) Option {
+	return func(engine *TaskEngine) {
+		engine.clock = c
+	}
+}
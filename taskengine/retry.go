@@ -0,0 +1,178 @@
+package taskengine
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrorTask define the task interface reporting failure, a failed ErrorTask is retried
+// according to the RetryPolicy set by WithRetry.
+// The engine calls RunError instead of Run/RunContext if a task implements ErrorTask.
+type ErrorTask interface {
+	Task
+	RunError(ctx context.Context) error
+}
+
+// ErrorTaskFunc define the error task func type
+type ErrorTaskFunc func(ctx context.Context) error
+
+// Run implements the Task interface
+func (f ErrorTaskFunc) Run() {
+	// nolint:errcheck
+	_ = f(context.Background())
+}
+
+// RunError implements the ErrorTask interface
+func (f ErrorTaskFunc) RunError(ctx context.Context) error {
+	return f(ctx)
+}
+
+// DeadLetterFunc is called when a task fails for the last time
+type DeadLetterFunc func(task Task, err error, attempts int)
+
+// RetryPolicy defines how a failed ErrorTask is retried.
+//
+// The delay before the n-th retry is InitialBackoff * Multiplier^(n-1), capped by MaxBackoff,
+// and randomized by ±Jitter of itself. The task waits the delay on a timer without holding a concurrency slot.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of runs including the first one, default 3
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, default 100ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay, default 30s
+	MaxBackoff time.Duration
+	// Multiplier is the growth factor of delay, default 2
+	Multiplier float64
+	// Jitter is the randomization factor of delay in [0, 1]
+	Jitter float64
+	// Retryable decides if an error should be retried, nil means all errors are retryable
+	Retryable func(err error) bool
+	// DeadLetter is called when the task is exhausted, not retryable or the engine stopped, optional
+	DeadLetter DeadLetterFunc
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff return the delay before the n-th retry
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	delay := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(n-1))
+	if delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		// nolint:gosec
+		delay *= 1 + p.Jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(delay)
+}
+
+// WithRetry set the retry policy of an ErrorTask
+func WithRetry(policy RetryPolicy) TaskOption {
+	policy = policy.withDefaults()
+
+	return func(item *taskItem) {
+		item.retry = &policy
+	}
+}
+
+// withDone set the callback called with the final error of an ErrorTask
+func withDone(f func(err error)) TaskOption {
+	return func(item *taskItem) {
+		item.done = f
+	}
+}
+
+// afterRun retry the failed task, or finish it, retrying is true if the task will run again
+func (engine *TaskEngine) afterRun(item *taskItem, err error) (retrying bool) {
+	item.attempt++
+
+	switch {
+	case err == nil || item.retry == nil:
+		item.finish(err)
+	case item.attempt >= item.retry.MaxAttempts || !item.retry.retryable(err):
+		engine.deadLetter(item, err)
+	default:
+		// the wait group must not grow once the engine stops
+		engine.mu.Lock()
+		if engine.state != StateRunning {
+			engine.mu.Unlock()
+			engine.deadLetter(item, err)
+			return false
+		}
+		engine.Add(1)
+		engine.mu.Unlock()
+
+		delay := item.retry.backoff(item.attempt)
+		engine.logger.Warn("task failed, retry later",
+			zap.Int("attempt", item.attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		go engine.retryAfter(item, err, delay)
+		return true
+	}
+	return false
+}
+
+func (engine *TaskEngine) retryAfter(item *taskItem, lastErr error, delay time.Duration) {
+	defer engine.Done()
+
+	timer := engine.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-engine.ctx.Done():
+		engine.giveUp(item, lastErr)
+		return
+	case <-timer.C():
+	}
+
+	if err := engine.scheduleItem(engine.ctx, item.retryItem()); err != nil {
+		engine.logger.Error("reschedule failed task", zap.Error(err))
+		engine.giveUp(item, lastErr)
+	}
+}
+
+// giveUp dead-letter the task waiting for retry, and release its key
+func (engine *TaskEngine) giveUp(item *taskItem, err error) {
+	engine.deadLetter(item, err)
+
+	if item.serial != nil {
+		engine.mu.Lock()
+		engine.nextSerial(item, false)
+		engine.mu.Unlock()
+	}
+}
+
+func (engine *TaskEngine) deadLetter(item *taskItem, err error) {
+	engine.logger.Error("task dead-lettered", zap.Int("attempts", item.attempt), zap.Error(err))
+
+	if item.retry.DeadLetter != nil {
+		item.retry.DeadLetter(item.task, err, item.attempt)
+	}
+	item.finish(err)
+}
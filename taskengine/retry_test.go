@@ -0,0 +1,127 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k81/kate/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+	}.withDefaults()
+
+	require.Equal(t, 3, policy.MaxAttempts)
+	require.Equal(t, 10*time.Millisecond, policy.backoff(1))
+	require.Equal(t, 20*time.Millisecond, policy.backoff(2))
+	require.Equal(t, 40*time.Millisecond, policy.backoff(3))
+	require.Equal(t, 50*time.Millisecond, policy.backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.backoff(1)
+		require.True(t, delay >= 5*time.Millisecond && delay <= 15*time.Millisecond)
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	var (
+		attempts atomic.Int32
+		errBoom  = errors.New("boom")
+	)
+
+	future := Submit(engine, func(context.Context) (int32, error) {
+		if n := attempts.Inc(); n < 3 {
+			return 0, errBoom
+		}
+		return attempts.Load(), nil
+	}, WithRetry(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}))
+
+	value, err := future.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(3), value)
+}
+
+func TestRetryFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithClock(c))
+	defer engine.Shutdown(context.Background())
+
+	var attempts atomic.Int32
+	future := Submit(engine, func(context.Context) (int32, error) {
+		if attempts.Inc() == 1 {
+			return 0, errors.New("boom")
+		}
+		return attempts.Load(), nil
+	}, WithRetry(RetryPolicy{InitialBackoff: time.Hour}))
+
+	// the retry waits for the backoff on the fake clock
+	c.BlockUntil(1)
+	require.Equal(t, int32(1), attempts.Load())
+	c.Advance(time.Hour)
+
+	value, err := future.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(2), value)
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	var (
+		errBoom  = errors.New("boom")
+		errFatal = errors.New("fatal")
+		dead     = make(chan int, 2)
+		policy   = RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Retryable: func(err error) bool {
+				return err != errFatal
+			},
+			DeadLetter: func(task Task, err error, attempts int) {
+				dead <- attempts
+			},
+		}
+	)
+
+	exhausted := Submit(engine, func(context.Context) (int, error) {
+		return 0, errBoom
+	}, WithRetry(policy))
+
+	_, err := exhausted.Wait(context.Background())
+	require.Equal(t, errBoom, err)
+	require.Equal(t, 3, <-dead)
+
+	fatal := Submit(engine, func(context.Context) (int, error) {
+		return 0, errFatal
+	}, WithRetry(policy))
+
+	_, err = fatal.Wait(context.Background())
+	require.Equal(t, errFatal, err)
+	require.Equal(t, 1, <-dead)
+}
+
+func TestRetryStopped(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop())
+
+	future := Submit(engine, func(context.Context) (int, error) {
+		return 0, errors.New("boom")
+	}, WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}))
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, engine.Shutdown(context.Background()))
+
+	_, err := future.Wait(context.Background())
+	require.EqualError(t, err, "boom")
+}
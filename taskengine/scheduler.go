@@ -0,0 +1,233 @@
+package taskengine
+
+// Priority defines the priority of task
+type Priority int
+
+const (
+	// PriorityLow is the priority for batch tasks
+	PriorityLow Priority = iota
+	// PriorityNormal is the default priority
+	PriorityNormal
+	// PriorityHigh is the priority for latency-sensitive tasks
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+// taskItem is a task waiting in the scheduler
+type taskItem struct {
+	task     Task
+	priority Priority
+	key      string
+	seq      uint64
+	// started is closed when the task is dispatched, non-nil if the caller waits for it
+	started    chan struct{}
+	dispatched bool
+	cancelled  bool
+	// retry is the retry policy of ErrorTask, attempt is the number of finished runs
+	retry   *RetryPolicy
+	attempt int
+	// done is called with the final error of ErrorTask
+	done func(err error)
+	// serial is the queue of the key scheduled by ScheduleKeyed
+	serial *serialQueue
+}
+
+// retryItem return a new item to run the task again
+func (item *taskItem) retryItem() *taskItem {
+	return &taskItem{
+		task:     item.task,
+		priority: item.priority,
+		key:      item.key,
+		retry:    item.retry,
+		attempt:  item.attempt,
+		done:     item.done,
+		serial:   item.serial,
+	}
+}
+
+func (item *taskItem) finish(err error) {
+	if item.done != nil {
+		item.done(err)
+	}
+}
+
+// keyQueue is the FIFO queue of a fair key
+type keyQueue struct {
+	key    string
+	items  []*taskItem
+	weight int
+	served int
+}
+
+// fairQueue is a weighted round-robin queue between fair keys,
+// a key is served up to its weight tasks in a row, and removed once it has no task.
+type fairQueue struct {
+	keys   map[string]*keyQueue
+	active []*keyQueue
+	cursor int
+}
+
+func (q *fairQueue) push(item *taskItem, weight int) {
+	if q.keys == nil {
+		q.keys = make(map[string]*keyQueue)
+	}
+
+	kq, ok := q.keys[item.key]
+	if !ok {
+		kq = &keyQueue{key: item.key, weight: weight}
+		q.keys[item.key] = kq
+		q.active = append(q.active, kq)
+	}
+	kq.items = append(kq.items, item)
+}
+
+// pop return the next task in weighted round-robin order, skipping the cancelled ones
+func (q *fairQueue) pop() *taskItem {
+	for len(q.active) > 0 {
+		if q.cursor >= len(q.active) {
+			q.cursor = 0
+		}
+
+		kq := q.active[q.cursor]
+		item := kq.items[0]
+		kq.items[0] = nil
+		kq.items = kq.items[1:]
+		kq.served++
+
+		switch {
+		case len(kq.items) == 0:
+			q.remove(q.cursor)
+		case kq.served >= kq.weight:
+			kq.served = 0
+			q.cursor++
+		}
+
+		if !item.cancelled {
+			return item
+		}
+	}
+	return nil
+}
+
+// dropOldest remove and return the oldest task
+func (q *fairQueue) dropOldest() *taskItem {
+	oldest := -1
+	for i, kq := range q.active {
+		if oldest < 0 || kq.items[0].seq < q.active[oldest].items[0].seq {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return nil
+	}
+
+	kq := q.active[oldest]
+	item := kq.items[0]
+	kq.items[0] = nil
+	kq.items = kq.items[1:]
+
+	if len(kq.items) == 0 {
+		q.remove(oldest)
+	}
+	return item
+}
+
+func (q *fairQueue) remove(i int) {
+	delete(q.keys, q.active[i].key)
+	copy(q.active[i:], q.active[i+1:])
+	q.active[len(q.active)-1] = nil
+	q.active = q.active[:len(q.active)-1]
+
+	if i < q.cursor {
+		q.cursor--
+	}
+}
+
+// scheduler decides which task runs next, by priority, concurrency reservation and fairness.
+// It is not goroutine-safe, the engine guards it with a mutex.
+type scheduler struct {
+	limit        int
+	running      int
+	runningByPri [numPriorities]int
+	reserved     [numPriorities]int
+	queues       [numPriorities]fairQueue
+	queued       int
+	capacity     int
+	weights      map[string]int
+	seq          uint64
+}
+
+// canStart return true if a task of priority p can start without using the slots
+// reserved for the higher priorities
+func (s *scheduler) canStart(p Priority) bool {
+	free := s.limit - s.running
+	for q := int(p) + 1; q < numPriorities; q++ {
+		if unused := s.reserved[q] - s.runningByPri[q]; unused > 0 {
+			free -= unused
+		}
+	}
+	return free > 0
+}
+
+func (s *scheduler) push(item *taskItem) {
+	weight := 1
+	if w, ok := s.weights[item.key]; ok && w > 0 {
+		weight = w
+	}
+
+	s.seq++
+	item.seq = s.seq
+	s.queues[item.priority].push(item, weight)
+	s.queued++
+}
+
+// pick dispatch the next task, from the highest priority that can start
+func (s *scheduler) pick() *taskItem {
+	for p := numPriorities - 1; p >= 0; p-- {
+		if !s.canStart(Priority(p)) {
+			continue
+		}
+
+		if item := s.queues[p].pop(); item != nil {
+			item.dispatched = true
+			s.queued--
+			s.running++
+			s.runningByPri[p]++
+			return item
+		}
+	}
+	return nil
+}
+
+func (s *scheduler) finish(item *taskItem) {
+	s.running--
+	s.runningByPri[item.priority]--
+}
+
+// cancel remove a task not dispatched yet, return false if it is already dispatched
+func (s *scheduler) cancel(item *taskItem) bool {
+	if item.dispatched || item.cancelled {
+		return false
+	}
+	item.cancelled = true
+	s.queued--
+	return true
+}
+
+// dropOldest remove the oldest task of the lowest priority
+func (s *scheduler) dropOldest() *taskItem {
+	for p := 0; p < numPriorities; p++ {
+		for {
+			item := s.queues[p].dropOldest()
+			if item == nil {
+				break
+			}
+			if !item.cancelled {
+				s.queued--
+				return item
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFairQueueWeightedRoundRobin(t *testing.T) {
+	s := &scheduler{
+		limit:   100,
+		weights: map[string]int{"a": 2},
+	}
+
+	for i := 0; i < 4; i++ {
+		s.push(&taskItem{key: "a", priority: PriorityNormal})
+		s.push(&taskItem{key: "b", priority: PriorityNormal})
+	}
+
+	var keys string
+	for item := s.pick(); item != nil; item = s.pick() {
+		keys += item.key
+	}
+	require.Equal(t, "aabaabbb", keys)
+	require.Empty(t, s.queues[PriorityNormal].keys, "idle keys should be removed")
+}
+
+func TestSchedulerReservation(t *testing.T) {
+	s := &scheduler{limit: 3}
+	s.reserved[PriorityHigh] = 1
+
+	for i := 0; i < 3; i++ {
+		s.push(&taskItem{priority: PriorityLow})
+	}
+
+	require.NotNil(t, s.pick())
+	require.NotNil(t, s.pick())
+	require.Nil(t, s.pick(), "the last slot is reserved for high priority")
+
+	s.push(&taskItem{priority: PriorityHigh})
+	item := s.pick()
+	require.NotNil(t, item)
+	require.Equal(t, PriorityHigh, item.priority)
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := &scheduler{limit: 1}
+
+	s.push(&taskItem{priority: PriorityLow})
+	s.push(&taskItem{priority: PriorityHigh})
+	s.push(&taskItem{priority: PriorityNormal})
+
+	var priorities []Priority
+	for item := s.pick(); item != nil; item = s.pick() {
+		priorities = append(priorities, item.priority)
+		s.finish(item)
+	}
+	require.Equal(t, []Priority{PriorityHigh, PriorityNormal, PriorityLow}, priorities)
+}
+
+func TestEnginePriority(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithQueue(10, OverflowReject))
+
+	var (
+		release = make(chan struct{})
+		started = make(chan struct{})
+		order   []string
+	)
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() {
+		close(started)
+		<-release
+	})))
+	<-started
+
+	record := func(name string) Task {
+		return TaskFunc(func() { order = append(order, name) })
+	}
+
+	require.NoError(t, engine.Schedule(record("low"), WithPriority(PriorityLow)))
+	require.NoError(t, engine.Schedule(record("normal")))
+	require.NoError(t, engine.Schedule(record("high"), WithPriority(PriorityHigh)))
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+
+	require.Equal(t, []string{"high", "normal", "low"}, order)
+}
@@ -1,5 +1,7 @@
 package taskengine
 
+import "context"
+
 // TaskFunc define the task func type
 type TaskFunc func()
 
@@ -12,3 +14,24 @@ func (f TaskFunc) Run() {
 type Task interface {
 	Run()
 }
+
+// ContextTask define the task interface receiving the engine context,
+// which is cancelled when the engine shuts down.
+// The engine calls RunContext instead of Run if a task implements ContextTask.
+type ContextTask interface {
+	Task
+	RunContext(ctx context.Context)
+}
+
+// ContextTaskFunc define the context task func type
+type ContextTaskFunc func(ctx context.Context)
+
+// Run implements the Task interface
+func (f ContextTaskFunc) Run() {
+	f(context.Background())
+}
+
+// RunContext implements the ContextTask interface
+func (f ContextTaskFunc) RunContext(ctx context.Context) {
+	f(ctx)
+}
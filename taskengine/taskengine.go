@@ -2,89 +2,453 @@ package taskengine
 
 import (
 	"fmt"
+	"runtime"
 	"sync"
 
 	"context"
 
+	"github.com/k81/kate/clock"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
+// State defines the state of task engine
+type State int
+
+const (
+	// StateRunning is the state accepting new tasks
+	StateRunning State = iota
+	// StateDraining is the state after Shutdown, waiting for the accepted tasks to finish
+	StateDraining
+	// StateStopped is the state after all the tasks finished
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
 // TaskEngine define the task engine
 type TaskEngine struct {
-	name              string
-	concurrencyTokens chan struct{}
-	ctx               context.Context
-	cancel            context.CancelFunc
-	logger            *zap.Logger
-	shutdown          bool
+	name           string
+	mu             sync.Mutex
+	sched          scheduler
+	changed        chan struct{}
+	queueMode      bool
+	overflowPolicy OverflowPolicy
+	limiter        *limiter
+	clock          clock.Clock
+	middlewares    []TaskMiddleware
+	serial         map[string]*serialQueue
+	parked         []*serialQueue
+	handler        TaskHandler
+	workers        sync.WaitGroup
+	running        atomic.Int64
+	ctx            context.Context
+	cancel         context.CancelFunc
+	logger         *zap.Logger
+	state          State
+	stopped        chan struct{}
 	sync.WaitGroup
 }
 
-// New create a new task engine
-func New(ctx context.Context, name string, concurrencyLevel int, logger *zap.Logger) *TaskEngine {
+// New create a new task engine.
+//
+// By default at most concurrencyLevel tasks run at the same time, and Schedule blocks until
+// the task starts, concurrencyLevel <= 0 means no limit. See WithQueue for the queue-backed mode,
+// and WithAdaptiveLimit for adjusting the concurrency at runtime.
+// The tasks are dispatched by priority, concurrency reservation and fair key, see TaskOption.
+func New(ctx context.Context, name string, concurrencyLevel int, logger *zap.Logger, opts ...Option) *TaskEngine {
 	newctx, cancel := context.WithCancel(ctx)
 
 	engine := &TaskEngine{
-		name:   name,
-		ctx:    newctx,
-		cancel: cancel,
-		logger: logger.With(zap.String("taskengine", name)),
+		name:    name,
+		changed: make(chan struct{}),
+		stopped: make(chan struct{}),
+		clock:   clock.New(),
+		ctx:     newctx,
+		cancel:  cancel,
+		logger:  logger.With(zap.String("taskengine", name)),
+	}
+
+	engine.middlewares = []TaskMiddleware{Recover(engine.logger)}
+
+	for _, opt := range opts {
+		opt(engine)
+	}
+
+	engine.handler = chainTask(engine.middlewares, runTask)
+
+	workers := concurrencyLevel
+	minLimit := concurrencyLevel
+
+	switch {
+	case engine.limiter != nil:
+		concurrencyLevel = engine.limiter.init(concurrencyLevel)
+		workers = engine.limiter.conf.Max
+		minLimit = engine.limiter.conf.Min
+	case engine.queueMode && concurrencyLevel <= 0:
+		concurrencyLevel = runtime.NumCPU()
+		workers = concurrencyLevel
+		minLimit = concurrencyLevel
 	}
 
-	if concurrencyLevel > 0 {
-		engine.concurrencyTokens = make(chan struct{}, concurrencyLevel)
+	if concurrencyLevel <= 0 {
+		return engine
+	}
+
+	reserved := 0
+	for _, n := range engine.sched.reserved {
+		reserved += n
+	}
+	if reserved >= minLimit {
+		panic(fmt.Sprintf("task engine %s reserves %d of %d concurrency", name, reserved, minLimit))
+	}
+
+	engine.sched.limit = concurrencyLevel
+	engine.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go engine.work()
 	}
 	return engine
 }
 
-// Schedule schedule a task running on engine
-func (engine *TaskEngine) Schedule(task Task) bool {
-	if engine.shutdown {
+// QueueLen return the number of tasks waiting to start
+func (engine *TaskEngine) QueueLen() int {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	return engine.sched.queued
+}
+
+// Capacity return the capacity of the task queue, 0 if not in queue-backed mode
+func (engine *TaskEngine) Capacity() int {
+	return engine.sched.capacity
+}
+
+// Running return the number of running tasks
+func (engine *TaskEngine) Running() int {
+	return int(engine.running.Load())
+}
+
+// Limit return the current concurrency limit, 0 means no limit
+func (engine *TaskEngine) Limit() int {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	return engine.sched.limit
+}
+
+// State return the state of the engine
+func (engine *TaskEngine) State() State {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	return engine.state
+}
+
+// Schedule schedule a task running on engine, blocks until the task starts,
+// or in queue-backed mode, handles the full queue according to the overflow policy
+func (engine *TaskEngine) Schedule(task Task, opts ...TaskOption) error {
+	return engine.ScheduleCtx(context.Background(), task, opts...)
+}
+
+// ScheduleCtx schedule a task running on engine like Schedule, but gives up with ctx.Err() when ctx is done
+func (engine *TaskEngine) ScheduleCtx(ctx context.Context, task Task, opts ...TaskOption) error {
+	return engine.scheduleItem(ctx, newTaskItem(task, opts))
+}
+
+func (engine *TaskEngine) scheduleItem(ctx context.Context, item *taskItem) error {
+	engine.mu.Lock()
+
+	if engine.state != StateRunning {
+		engine.mu.Unlock()
 		engine.logger.Error("already stopped, should not schedule new task")
-		return false
+		return ErrStopped
+	}
+
+	if engine.sched.limit <= 0 {
+		engine.Add(1)
+		engine.mu.Unlock()
+		go engine.runUnlimited(item)
+		return nil
+	}
+
+	if engine.queueMode {
+		return engine.enqueue(ctx, item)
+	}
+
+	item.started = make(chan struct{})
+	engine.sched.push(item)
+	engine.broadcast()
+	engine.mu.Unlock()
+
+	select {
+	case <-item.started:
+		return nil
+	case <-ctx.Done():
+		if engine.cancelItem(item) {
+			return ctx.Err()
+		}
+		return nil
+	case <-engine.ctx.Done():
+		if engine.cancelItem(item) {
+			return ErrStopped
+		}
+		return nil
+	}
+}
+
+// TrySchedule schedule a task running on engine without blocking,
+// ErrBusy is returned if the task can not start right now, or ErrQueueFull if the queue is full
+func (engine *TaskEngine) TrySchedule(task Task, opts ...TaskOption) error {
+	item := newTaskItem(task, opts)
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	if engine.state != StateRunning {
+		engine.logger.Error("already stopped, should not schedule new task")
+		return ErrStopped
+	}
+
+	if engine.sched.limit <= 0 {
+		engine.Add(1)
+		go engine.runUnlimited(item)
+		return nil
 	}
 
-	engine.Add(1)
+	switch {
+	case engine.queueMode && engine.sched.queued >= engine.sched.capacity:
+		return ErrQueueFull
+	case !engine.queueMode && (engine.sched.queued > 0 || !engine.sched.canStart(item.priority)):
+		return ErrBusy
+	}
+
+	engine.sched.push(item)
+	engine.broadcast()
+	return nil
+}
+
+// enqueue push the task into the queue, engine.mu must be held and is released on return
+func (engine *TaskEngine) enqueue(ctx context.Context, item *taskItem) error {
+	var released []*taskItem
 
-	if engine.concurrencyTokens != nil {
-		engine.concurrencyTokens <- struct{}{}
+	for engine.sched.queued >= engine.sched.capacity {
+		switch engine.overflowPolicy {
+		case OverflowReject:
+			engine.mu.Unlock()
+			return ErrQueueFull
+		case OverflowCallerRuns:
+			engine.Add(1)
+			engine.mu.Unlock()
+			defer engine.Done()
+			engine.run(item)
+			return nil
+		case OverflowDropOldest:
+			if dropped := engine.sched.dropOldest(); dropped != nil {
+				engine.logger.Warn("queue full, oldest task dropped", zap.Int("priority", int(dropped.priority)))
+				if dropped.serial != nil {
+					// the key is released once the room is taken, see below
+					released = append(released, dropped)
+				}
+				// finished after engine.mu is released, as the callbacks may schedule tasks
+				defer engine.drop(dropped)
+			}
+		default:
+			changed := engine.changed
+			engine.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-engine.ctx.Done():
+				return ErrStopped
+			case <-changed:
+			}
+
+			engine.mu.Lock()
+			if engine.state != StateRunning {
+				engine.mu.Unlock()
+				return ErrStopped
+			}
+		}
 	}
 
-	go engine.run(task)
+	engine.sched.push(item)
+	// the queue is full again, so the next tasks of the dropped keys wait for room instead of
+	// being pushed and dropped in turn
+	for _, dropped := range released {
+		engine.nextSerial(dropped, false)
+	}
+	engine.broadcast()
+	engine.mu.Unlock()
+	return nil
+}
+
+// drop finish a task dropped from the queue with ErrDropped, the ErrorTask with a retry policy
+// is dead-lettered
+func (engine *TaskEngine) drop(item *taskItem) {
+	if item.retry != nil {
+		engine.deadLetter(item, ErrDropped)
+		return
+	}
+	item.finish(ErrDropped)
+}
+
+func (engine *TaskEngine) cancelItem(item *taskItem) bool {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	if !engine.sched.cancel(item) {
+		return false
+	}
+	engine.broadcast()
 	return true
 }
 
-func (engine *TaskEngine) run(task Task) {
-	defer func() {
-		if r := recover(); r != nil {
-			engine.logger.Error("task panic:",
-				zap.Any("error", r),
-				zap.Stack("stack"),
-			)
+// broadcast wake up all the goroutines waiting for the scheduler state change, engine.mu must be held
+func (engine *TaskEngine) broadcast() {
+	close(engine.changed)
+	engine.changed = make(chan struct{})
+}
+
+func (engine *TaskEngine) work() {
+	defer engine.workers.Done()
+
+	for {
+		item := engine.next()
+		if item == nil {
+			return
 		}
-		if engine.concurrencyTokens != nil {
-			<-engine.concurrencyTokens
+
+		start := engine.clock.Now()
+		failed := engine.run(item)
+
+		engine.mu.Lock()
+		if engine.limiter != nil {
+			engine.adjustLimit(engine.clock.Since(start), failed)
+		}
+		engine.sched.finish(item)
+		engine.broadcast()
+		engine.mu.Unlock()
+	}
+}
+
+// next wait for the next task to dispatch, return nil when the engine is stopped and no task is left
+func (engine *TaskEngine) next() *taskItem {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for {
+		if item := engine.sched.pick(); item != nil {
+			if item.started != nil {
+				close(item.started)
+			}
+			// before the blocked Schedule calls, as the parked tasks were accepted earlier
+			engine.unpark()
+			engine.broadcast()
+			return item
 		}
-		engine.Done()
-	}()
 
-	task.Run()
+		// run the tasks already accepted before exit
+		stopped := engine.ctx.Done()
+		if engine.ctx.Err() != nil {
+			if engine.sched.queued == 0 {
+				return nil
+			}
+			stopped = nil
+		}
+
+		changed := engine.changed
+		engine.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-stopped:
+		}
+
+		engine.mu.Lock()
+	}
 }
 
-// Shutdown stop the task engine
-func (engine *TaskEngine) Shutdown() {
-	if engine.shutdown {
-		panic(fmt.Sprintf("task engine %s shutdown twice", engine.name))
+func (engine *TaskEngine) runUnlimited(item *taskItem) {
+	defer engine.Done()
+
+	engine.run(item)
+}
+
+// run run the task through the middleware chain, failed is true if it panics or returns an error
+func (engine *TaskEngine) run(item *taskItem) (failed bool) {
+	engine.running.Inc()
+	defer engine.running.Dec()
+
+	err := engine.handler(engine.ctx, item.task)
+
+	retrying := false
+	if _, ok := item.task.(ErrorTask); ok {
+		retrying = engine.afterRun(item, err)
 	}
 
-	engine.logger.Info("stopping")
+	// the key is held until the last attempt
+	if item.serial != nil && !retrying {
+		engine.mu.Lock()
+		engine.nextSerial(item, true)
+		engine.mu.Unlock()
+	}
+	return err != nil
+}
 
-	engine.shutdown = true
-	engine.cancel()
-	engine.WaitGroup.Wait()
+// Shutdown stop the task engine, it is safe to call Shutdown more than once and concurrently.
+//
+// The engine stops accepting new tasks, cancels the context of tasks, and waits for the running
+// and queued tasks to finish. If ctx is done before that, an *UnfinishedError reporting the number
+// of unfinished tasks is returned, and the engine keeps stopping in background.
+func (engine *TaskEngine) Shutdown(ctx context.Context) error {
+	engine.mu.Lock()
+	if engine.state == StateRunning {
+		engine.logger.Info("stopping")
+
+		engine.state = StateDraining
+		engine.cancel()
+		engine.broadcast()
+
+		go engine.drain()
+	}
+	engine.mu.Unlock()
+
+	select {
+	case <-engine.stopped:
+		return nil
+	case <-ctx.Done():
+	}
 
-	if engine.concurrencyTokens != nil {
-		close(engine.concurrencyTokens)
+	engine.mu.Lock()
+	err := &UnfinishedError{
+		Queued:  engine.sched.queued + engine.serialPending(),
+		Running: engine.Running(),
+		Err:     ctx.Err(),
 	}
+	engine.mu.Unlock()
+
+	engine.logger.Error("stop timeout", zap.Int("queued", err.Queued), zap.Int("running", err.Running))
+	return err
+}
+
+// drain wait for the tasks to finish and mark the engine stopped
+func (engine *TaskEngine) drain() {
+	engine.workers.Wait()
+	engine.WaitGroup.Wait()
+
+	engine.mu.Lock()
+	engine.state = StateStopped
+	engine.mu.Unlock()
+
+	close(engine.stopped)
 	engine.logger.Info("stopped")
 }
@@ -0,0 +1,225 @@
+package taskengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestTrySchedule(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	release := make(chan struct{})
+	require.NoError(t, engine.TrySchedule(TaskFunc(func() { <-release })))
+	require.Equal(t, ErrBusy, engine.TrySchedule(TaskFunc(func() {})))
+
+	close(release)
+}
+
+func TestScheduleCtx(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop())
+	defer engine.Shutdown(context.Background())
+
+	release := make(chan struct{})
+	require.NoError(t, engine.Schedule(TaskFunc(func() { <-release })))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.Equal(t, context.DeadlineExceeded, engine.ScheduleCtx(ctx, TaskFunc(func() {})))
+
+	close(release)
+}
+
+func TestContextTask(t *testing.T) {
+	engine := New(context.Background(), "test", 0, zap.NewNop())
+
+	cancelled := make(chan struct{})
+	require.NoError(t, engine.Schedule(ContextTaskFunc(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})))
+
+	require.NoError(t, engine.Shutdown(context.Background()))
+
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("context task should see the engine cancellation")
+	}
+
+	require.Equal(t, ErrStopped, engine.Schedule(TaskFunc(func() {})))
+}
+
+func newBlockedQueueEngine(t *testing.T, policy OverflowPolicy) (*TaskEngine, chan struct{}) {
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithQueue(1, policy))
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() {
+		close(started)
+		<-release
+	})))
+	<-started
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() {})))
+	require.Equal(t, 1, engine.Running())
+	require.Equal(t, 1, engine.QueueLen())
+	require.Equal(t, 1, engine.Capacity())
+	return engine, release
+}
+
+func TestQueueReject(t *testing.T) {
+	engine, release := newBlockedQueueEngine(t, OverflowReject)
+
+	require.Equal(t, ErrQueueFull, engine.Schedule(TaskFunc(func() {})))
+	require.Equal(t, ErrQueueFull, engine.TrySchedule(TaskFunc(func() {})))
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+}
+
+func TestQueueBlock(t *testing.T) {
+	engine, release := newBlockedQueueEngine(t, OverflowBlock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, engine.ScheduleCtx(ctx, TaskFunc(func() {})))
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	engine, release := newBlockedQueueEngine(t, OverflowDropOldest)
+
+	var ran atomic.Bool
+	require.NoError(t, engine.Schedule(TaskFunc(func() { ran.Store(true) })))
+	require.Equal(t, 1, engine.QueueLen())
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.True(t, ran.Load(), "newest task should be kept")
+}
+
+func TestQueueDropOldestFinish(t *testing.T) {
+	engine, release := newBlockedQueueEngine(t, OverflowDropOldest)
+
+	future := Submit(engine, func(context.Context) (int, error) { return 1, nil })
+
+	var (
+		deadErr  error
+		attempts int
+	)
+	policy := RetryPolicy{DeadLetter: func(task Task, err error, n int) {
+		deadErr, attempts = err, n
+	}}
+	task := ErrorTaskFunc(func(context.Context) error { return nil })
+	require.NoError(t, engine.Schedule(task, WithRetry(policy)))
+
+	_, err := future.Wait(context.Background())
+	require.Equal(t, ErrDropped, err)
+
+	require.NoError(t, engine.Schedule(TaskFunc(func() {})))
+	require.Equal(t, ErrDropped, deadErr)
+	require.Equal(t, 0, attempts)
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+}
+
+func TestQueueCallerRuns(t *testing.T) {
+	engine, release := newBlockedQueueEngine(t, OverflowCallerRuns)
+
+	ran := false
+	require.NoError(t, engine.Schedule(TaskFunc(func() { ran = true })))
+	require.True(t, ran, "task should run in the caller goroutine")
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+}
+
+func TestShutdownIdempotent(t *testing.T) {
+	engine := New(context.Background(), "test", 2, zap.NewNop())
+	require.Equal(t, StateRunning, engine.State())
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- engine.Shutdown(context.Background())
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+
+	require.Equal(t, StateStopped, engine.State())
+	require.NoError(t, engine.Shutdown(context.Background()))
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	engine := New(context.Background(), "test", 1, zap.NewNop(), WithQueue(4, OverflowReject))
+
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, engine.Schedule(TaskFunc(func() { <-release })))
+	}
+
+	require.Eventually(t, func() bool { return engine.Running() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := engine.Shutdown(ctx)
+	var unfinished *UnfinishedError
+	require.ErrorAs(t, err, &unfinished)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 2, unfinished.Queued)
+	require.Equal(t, 1, unfinished.Running)
+	require.Equal(t, StateDraining, engine.State())
+	require.Equal(t, ErrStopped, engine.TrySchedule(TaskFunc(func() {})))
+
+	close(release)
+	require.NoError(t, engine.Shutdown(context.Background()))
+	require.Equal(t, StateStopped, engine.State())
+}
+
+func TestShutdownRace(t *testing.T) {
+	for _, level := range []int{0, 2} {
+		engine := New(context.Background(), "test", level, zap.NewNop())
+
+		var (
+			wg   sync.WaitGroup
+			errs = make(chan error, 8)
+		)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					if err := engine.Schedule(TaskFunc(func() {})); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		time.Sleep(time.Millisecond)
+		require.NoError(t, engine.Shutdown(context.Background()))
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.Equal(t, ErrStopped, err)
+		}
+
+		require.Equal(t, ErrStopped, engine.Schedule(TaskFunc(func() {})))
+	}
+}
@@ -0,0 +1,522 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/k81/kate/rdb"
+	"github.com/k81/kate/taskengine"
+	"go.uber.org/zap"
+)
+
+const (
+	fieldType     = "type"
+	fieldPayload  = "payload"
+	fieldID       = "id"
+	fieldError    = "error"
+	fieldAttempts = "attempts"
+)
+
+// Handler handles the json payload of a task type, the message is acknowledged if it returns nil
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Config defines the config of durable queue
+type Config struct {
+	// Stream is the redis stream key of the queue
+	Stream string
+	// Group is the consumer group name, default is "workers"
+	Group string
+	// Consumer is the consumer name of this process, default is "<hostname>-<pid>"
+	Consumer string
+	// DeadLetterStream is the stream key of dead-lettered messages, default is Stream + ":dead"
+	DeadLetterStream string
+	// VisibilityTimeout is the time after which an unacknowledged message is delivered again, default is 30s
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is the max number of deliveries before a message is dead-lettered, default is 5
+	MaxDeliveries int64
+	// BatchSize is the max number of messages read at a time, default is 10
+	BatchSize int64
+	// BlockTimeout is the max time a read blocks waiting for messages, default is 1s
+	BlockTimeout time.Duration
+	// MaxLen trims the stream to approximately MaxLen messages on enqueue, 0 means no trimming
+	MaxLen int64
+	// DeleteOnAck deletes a message from the stream once acknowledged, it should only be set if
+	// the stream is consumed by this group alone, as the other groups would miss the message
+	DeleteOnAck bool
+}
+
+// streamClient is the redis commands used by the queue
+type streamClient interface {
+	XAdd(a *redis.XAddArgs) (string, error)
+	XGroupCreateMkStream(stream, group, start string) error
+	XReadGroup(a *redis.XReadGroupArgs) ([]redis.XStream, error)
+	XPendingExt(a *redis.XPendingExtArgs) ([]redis.XPendingExt, error)
+	XClaim(a *redis.XClaimArgs) ([]redis.XMessage, error)
+	XClaimJustID(a *redis.XClaimArgs) ([]string, error)
+	XAck(stream, group string, ids ...string) error
+	XDel(stream string, ids ...string) error
+}
+
+// redisClient implements streamClient with rdb.Client
+type redisClient struct {
+	client rdb.Client
+}
+
+func (c redisClient) XAdd(a *redis.XAddArgs) (string, error) {
+	return c.client.XAdd(a).Result()
+}
+
+func (c redisClient) XGroupCreateMkStream(stream, group, start string) error {
+	return c.client.XGroupCreateMkStream(stream, group, start).Err()
+}
+
+func (c redisClient) XReadGroup(a *redis.XReadGroupArgs) ([]redis.XStream, error) {
+	return c.client.XReadGroup(a).Result()
+}
+
+func (c redisClient) XPendingExt(a *redis.XPendingExtArgs) ([]redis.XPendingExt, error) {
+	return c.client.XPendingExt(a).Result()
+}
+
+func (c redisClient) XClaim(a *redis.XClaimArgs) ([]redis.XMessage, error) {
+	return c.client.XClaim(a).Result()
+}
+
+func (c redisClient) XClaimJustID(a *redis.XClaimArgs) ([]string, error) {
+	return c.client.XClaimJustID(a).Result()
+}
+
+func (c redisClient) XAck(stream, group string, ids ...string) error {
+	return c.client.XAck(stream, group, ids...).Err()
+}
+
+func (c redisClient) XDel(stream string, ids ...string) error {
+	return c.client.XDel(stream, ids...).Err()
+}
+
+// Queue is a durable task queue backed by redis streams with consumer groups.
+//
+// Messages are delivered at least once: a message not acknowledged within the visibility timeout,
+// e.g. the handler failed or the process crashed, is claimed and delivered again, and moved to
+// the dead-letter stream after MaxDeliveries. The claim of a message is extended while its handler
+// is running, so a handler may run longer than the visibility timeout. Handlers should be idempotent.
+type Queue struct {
+	client   streamClient
+	engine   *taskengine.TaskEngine
+	conf     Config
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	logger   *zap.Logger
+}
+
+// New create a durable queue, the messages are handled by tasks scheduled on engine
+func New(client rdb.Client, engine *taskengine.TaskEngine, conf Config, logger *zap.Logger) *Queue {
+	return newQueue(redisClient{client: client}, engine, conf, logger)
+}
+
+func newQueue(client streamClient, engine *taskengine.TaskEngine, conf Config, logger *zap.Logger) *Queue {
+	if conf.Stream == "" {
+		panic("taskqueue: stream is required")
+	}
+	if conf.Group == "" {
+		conf.Group = "workers"
+	}
+	if conf.Consumer == "" {
+		hostname, _ := os.Hostname()
+		conf.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if conf.DeadLetterStream == "" {
+		conf.DeadLetterStream = conf.Stream + ":dead"
+	}
+	if conf.VisibilityTimeout <= 0 {
+		conf.VisibilityTimeout = 30 * time.Second
+	}
+	if conf.MaxDeliveries <= 0 {
+		conf.MaxDeliveries = 5
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 10
+	}
+	if conf.BlockTimeout <= 0 {
+		conf.BlockTimeout = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		client:   client,
+		engine:   engine,
+		conf:     conf,
+		handlers: make(map[string]Handler),
+		ctx:      ctx,
+		cancel:   cancel,
+		logger:   logger.With(zap.String("taskqueue", conf.Stream)),
+	}
+}
+
+// Register register the handler of a task type
+func (q *Queue) Register(taskType string, h Handler) {
+	q.mu.Lock()
+	q.handlers[taskType] = h
+	q.mu.Unlock()
+}
+
+// RegisterFunc register a handler receiving the payload decoded into T
+func RegisterFunc[T any](q *Queue, taskType string, f func(ctx context.Context, payload T) error) {
+	q.Register(taskType, func(ctx context.Context, data json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return Permanent(fmt.Errorf("decode %s payload: %w", taskType, err))
+		}
+		return f(ctx, payload)
+	})
+}
+
+// Enqueue add a task to the queue, payload is serialized as json, the message id is returned
+func (q *Queue) Enqueue(taskType string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encode %s payload: %w", taskType, err)
+	}
+
+	return q.client.XAdd(&redis.XAddArgs{
+		Stream:       q.conf.Stream,
+		MaxLenApprox: q.conf.MaxLen,
+		Values: map[string]interface{}{
+			fieldType:    taskType,
+			fieldPayload: string(data),
+		},
+	})
+}
+
+// Start create the consumer group if not exists, and start consuming the queue
+func (q *Queue) Start() error {
+	err := q.client.XGroupCreateMkStream(q.conf.Stream, q.conf.Group, "0")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+
+	q.wg.Add(2)
+	go q.consume()
+	go q.reclaim()
+
+	q.logger.Info("taskqueue started", zap.String("group", q.conf.Group), zap.String("consumer", q.conf.Consumer))
+	return nil
+}
+
+// Stop stop consuming the queue, the messages being handled are left to the engine,
+// and the ones not acknowledged are delivered again after the visibility timeout.
+func (q *Queue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+	q.logger.Info("taskqueue stopped")
+}
+
+// consume read the new messages of the group
+func (q *Queue) consume() {
+	defer q.wg.Done()
+
+	for q.ctx.Err() == nil {
+		streams, err := q.client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    q.conf.Group,
+			Consumer: q.conf.Consumer,
+			Streams:  []string{q.conf.Stream, ">"},
+			Count:    q.conf.BatchSize,
+			Block:    q.conf.BlockTimeout,
+		})
+
+		switch {
+		case err == redis.Nil:
+			continue
+		case err != nil:
+			q.logger.Error("read messages", zap.Error(err))
+			q.sleep(q.conf.BlockTimeout)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				q.schedule(msg, 1)
+			}
+		}
+	}
+}
+
+// reclaim claim the messages exceeding the visibility timeout, from the crashed or failed consumers
+func (q *Queue) reclaim() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.conf.VisibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		q.claimIdle()
+	}
+}
+
+// claimIdle page through all the pending messages of the group, and claim the idle ones
+func (q *Queue) claimIdle() {
+	start := "-"
+
+	for q.ctx.Err() == nil {
+		pending, err := q.client.XPendingExt(&redis.XPendingExtArgs{
+			Stream: q.conf.Stream,
+			Group:  q.conf.Group,
+			Start:  start,
+			End:    "+",
+			Count:  q.conf.BatchSize,
+		})
+		if err != nil {
+			q.logger.Error("list pending messages", zap.Error(err))
+			return
+		}
+
+		for _, p := range pending {
+			if p.Idle >= q.conf.VisibilityTimeout {
+				q.claim(p)
+			}
+		}
+
+		if int64(len(pending)) < q.conf.BatchSize {
+			return
+		}
+		start = nextID(pending[len(pending)-1].Id)
+	}
+}
+
+func (q *Queue) claim(p redis.XPendingExt) {
+	msgs, err := q.client.XClaim(&redis.XClaimArgs{
+		Stream:   q.conf.Stream,
+		Group:    q.conf.Group,
+		Consumer: q.conf.Consumer,
+		MinIdle:  q.conf.VisibilityTimeout,
+		Messages: []string{p.Id},
+	})
+	if err != nil {
+		q.logger.Error("claim message", zap.String("id", p.Id), zap.Error(err))
+		return
+	}
+
+	for _, msg := range msgs {
+		if p.RetryCount >= q.conf.MaxDeliveries {
+			q.deadLetter(msg, p.RetryCount, errors.New("max deliveries exceeded"))
+			continue
+		}
+		// claiming counts as a delivery
+		q.schedule(msg, p.RetryCount+1)
+	}
+}
+
+func (q *Queue) schedule(msg redis.XMessage, deliveries int64) {
+	task := taskengine.ErrorTaskFunc(func(ctx context.Context) error {
+		return q.handle(ctx, msg, deliveries)
+	})
+
+	// the message stays pending if not scheduled, and is claimed again after the visibility timeout
+	if err := q.engine.ScheduleCtx(q.ctx, task); err != nil {
+		q.logger.Warn("schedule message", zap.String("id", msg.ID), zap.Error(err))
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, msg redis.XMessage, deliveries int64) (err error) {
+	taskType, payload := messageValue(msg, fieldType), messageValue(msg, fieldPayload)
+
+	q.mu.RLock()
+	h, ok := q.handlers[taskType]
+	q.mu.RUnlock()
+
+	if !ok {
+		q.deadLetter(msg, deliveries, fmt.Errorf("unknown task type: %v", taskType))
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			q.logger.Error("task panic", zap.String("id", msg.ID), zap.Any("error", r), zap.Stack("stack"))
+		}
+
+		switch {
+		case err == nil:
+			q.ack(msg.ID)
+		case IsPermanent(err) || deliveries >= q.conf.MaxDeliveries:
+			q.deadLetter(msg, deliveries, err)
+		default:
+			q.logger.Warn("task failed, deliver again after visibility timeout",
+				zap.String("id", msg.ID),
+				zap.String("type", taskType),
+				zap.Int64("deliveries", deliveries),
+				zap.Error(err),
+			)
+		}
+	}()
+
+	// stopped before the message is acknowledged above
+	stop := q.keepClaim(msg.ID)
+	defer stop()
+
+	return h(ctx, json.RawMessage(payload))
+}
+
+// keepClaim reset the idle time of the message periodically while it is handled, so that it is not
+// claimed by others if the handler runs longer than the visibility timeout. It gives up once the
+// message is lost, i.e. acknowledged or claimed by others since the last reset.
+func (q *Queue) keepClaim(id string) (stop func()) {
+	var (
+		done     = make(chan struct{})
+		exited   = make(chan struct{})
+		interval = q.conf.VisibilityTimeout / 3
+	)
+
+	go func() {
+		defer close(exited)
+
+		// not a ticker, so the resets are at least interval apart
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+
+			// a message claimed by others since the last reset is likely idle for less than min idle,
+			// and not claimed back, the margin is for the network delay. JUSTID does not count as a delivery.
+			ids, err := q.client.XClaimJustID(&redis.XClaimArgs{
+				Stream:   q.conf.Stream,
+				Group:    q.conf.Group,
+				Consumer: q.conf.Consumer,
+				MinIdle:  interval * 3 / 4,
+				Messages: []string{id},
+			})
+			if err != nil {
+				q.logger.Warn("extend message claim", zap.String("id", id), zap.Error(err))
+			} else if len(ids) == 0 {
+				q.logger.Warn("message claimed by others", zap.String("id", id))
+				return
+			}
+			timer.Reset(interval)
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+func (q *Queue) ack(id string) {
+	if err := q.client.XAck(q.conf.Stream, q.conf.Group, id); err != nil {
+		q.logger.Error("ack message", zap.String("id", id), zap.Error(err))
+		return
+	}
+
+	if q.conf.DeleteOnAck {
+		if err := q.client.XDel(q.conf.Stream, id); err != nil {
+			q.logger.Warn("delete message", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// deadLetter move the message to the dead-letter stream
+func (q *Queue) deadLetter(msg redis.XMessage, deliveries int64, cause error) {
+	q.logger.Error("task dead-lettered",
+		zap.String("id", msg.ID),
+		zap.String("type", messageValue(msg, fieldType)),
+		zap.Int64("deliveries", deliveries),
+		zap.Error(cause),
+	)
+
+	_, err := q.client.XAdd(&redis.XAddArgs{
+		Stream: q.conf.DeadLetterStream,
+		Values: map[string]interface{}{
+			fieldType:     messageValue(msg, fieldType),
+			fieldPayload:  messageValue(msg, fieldPayload),
+			fieldID:       msg.ID,
+			fieldError:    cause.Error(),
+			fieldAttempts: deliveries,
+		},
+	})
+	if err != nil {
+		// keep it pending, so it is not lost
+		q.logger.Error("add dead-letter message", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+
+	q.ack(msg.ID)
+}
+
+func (q *Queue) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-q.ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// nextID return the smallest stream id after id, for paging through the ids exclusively
+func nextID(id string) string {
+	ms, seq, _ := strings.Cut(id, "-")
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n == math.MaxUint64 {
+		t, _ := strconv.ParseUint(ms, 10, 64)
+		return strconv.FormatUint(t+1, 10) + "-0"
+	}
+	return ms + "-" + strconv.FormatUint(n+1, 10)
+}
+
+func messageValue(msg redis.XMessage, field string) string {
+	if v, ok := msg.Values[field]; ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wrap err to dead-letter the message at once, without delivering it again
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent return true if err is wrapped by Permanent
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
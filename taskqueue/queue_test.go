@@ -0,0 +1,354 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/k81/kate/taskengine"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakePending struct {
+	consumer  string
+	delivered time.Time
+	count     int64
+}
+
+// fakeRedis is an in-memory redis supporting the stream commands used by queue, with a single group
+type fakeRedis struct {
+	streamClient
+	mu      sync.Mutex
+	seq     int
+	streams map[string][]redis.XMessage
+	pending map[string]*fakePending
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		streams: make(map[string][]redis.XMessage),
+		pending: make(map[string]*fakePending),
+	}
+}
+
+func parseID(id string) int {
+	ms, _, _ := strings.Cut(id, "-")
+	n, _ := strconv.Atoi(ms)
+	return n
+}
+
+// deliver add a message pending for consumer, delivered idle ago
+func (r *fakeRedis) deliver(consumer string, idle time.Duration, count int64, values map[string]interface{}) string {
+	id, _ := r.XAdd(&redis.XAddArgs{Stream: "tasks", Values: values})
+
+	r.mu.Lock()
+	r.pending[id] = &fakePending{consumer: consumer, delivered: time.Now().Add(-idle), count: count}
+	r.mu.Unlock()
+	return id
+}
+
+func (r *fakeRedis) stream(name string) []redis.XMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]redis.XMessage(nil), r.streams[name]...)
+}
+
+func (r *fakeRedis) pendingCount(id string) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.pending[id]
+	if !ok {
+		return 0, false
+	}
+	return p.count, true
+}
+
+func (r *fakeRedis) XAdd(a *redis.XAddArgs) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	id := fmt.Sprintf("%d-0", r.seq)
+	r.streams[a.Stream] = append(r.streams[a.Stream], redis.XMessage{ID: id, Values: a.Values})
+	return id, nil
+}
+
+func (r *fakeRedis) XDel(stream string, ids ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		msgs := r.streams[stream]
+		for i := range msgs {
+			if msgs[i].ID == id {
+				r.streams[stream] = append(msgs[:i], msgs[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fakeRedis) XAck(stream, group string, ids ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		delete(r.pending, id)
+	}
+	return nil
+}
+
+func (r *fakeRedis) XPendingExt(a *redis.XPendingExtArgs) ([]redis.XPendingExt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.pending))
+	for id, p := range r.pending {
+		if (a.Start == "-" || parseID(id) >= parseID(a.Start)) &&
+			(a.End == "+" || parseID(id) <= parseID(a.End)) &&
+			(a.Consumer == "" || a.Consumer == p.consumer) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return parseID(ids[i]) < parseID(ids[j]) })
+	if int64(len(ids)) > a.Count {
+		ids = ids[:a.Count]
+	}
+
+	val := make([]redis.XPendingExt, 0, len(ids))
+	for _, id := range ids {
+		p := r.pending[id]
+		val = append(val, redis.XPendingExt{Id: id, Consumer: p.consumer, Idle: time.Since(p.delivered), RetryCount: p.count})
+	}
+	return val, nil
+}
+
+func (r *fakeRedis) claim(a *redis.XClaimArgs, justID bool) []redis.XMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var msgs []redis.XMessage
+	for _, id := range a.Messages {
+		p, ok := r.pending[id]
+		if !ok || time.Since(p.delivered) < a.MinIdle {
+			continue
+		}
+
+		p.consumer = a.Consumer
+		p.delivered = time.Now()
+		if !justID {
+			p.count++
+		}
+
+		for _, msg := range r.streams[a.Stream] {
+			if msg.ID == id {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return msgs
+}
+
+func (r *fakeRedis) XClaim(a *redis.XClaimArgs) ([]redis.XMessage, error) {
+	return r.claim(a, false), nil
+}
+
+func (r *fakeRedis) XClaimJustID(a *redis.XClaimArgs) ([]string, error) {
+	var ids []string
+	for _, msg := range r.claim(a, true) {
+		ids = append(ids, msg.ID)
+	}
+	return ids, nil
+}
+
+func newTestQueue(t *testing.T, conf Config) (*Queue, *fakeRedis) {
+	engine := taskengine.New(context.Background(), "test", 4, zap.NewNop())
+	t.Cleanup(func() {
+		require.NoError(t, engine.Shutdown(context.Background()))
+	})
+
+	client := newFakeRedis()
+	conf.Stream = "tasks"
+	return newQueue(client, engine, conf, zap.NewNop()), client
+}
+
+func TestPermanent(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	require.Nil(t, Permanent(nil))
+	require.False(t, IsPermanent(errBoom))
+	require.True(t, IsPermanent(Permanent(errBoom)))
+	require.True(t, IsPermanent(fmt.Errorf("wrapped: %w", Permanent(errBoom))))
+	require.True(t, errors.Is(Permanent(errBoom), errBoom))
+}
+
+func TestRegisterFunc(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	q := New(nil, nil, Config{Stream: "tasks"}, zap.NewNop())
+	require.Equal(t, "tasks:dead", q.conf.DeadLetterStream)
+
+	var got payload
+	RegisterFunc(q, "greet", func(ctx context.Context, p payload) error {
+		got = p
+		return nil
+	})
+
+	h := q.handlers["greet"]
+	require.NoError(t, h(context.Background(), json.RawMessage(`{"name":"kate"}`)))
+	require.Equal(t, "kate", got.Name)
+	require.True(t, IsPermanent(h(context.Background(), json.RawMessage(`{"name":1}`))))
+}
+
+func TestAck(t *testing.T) {
+	q, client := newTestQueue(t, Config{})
+
+	id := client.deliver(q.conf.Consumer, 0, 1, nil)
+	q.ack(id)
+	_, ok := client.pendingCount(id)
+	require.False(t, ok)
+	require.Len(t, client.stream("tasks"), 1, "kept for the other groups")
+
+	q.conf.DeleteOnAck = true
+	id = client.deliver(q.conf.Consumer, 0, 1, nil)
+	q.ack(id)
+	require.Len(t, client.stream("tasks"), 1)
+}
+
+func TestReclaim(t *testing.T) {
+	q, client := newTestQueue(t, Config{BatchSize: 3, MaxDeliveries: 2, VisibilityTimeout: time.Minute})
+
+	var handled atomic.Int32
+	q.Register("count", func(ctx context.Context, payload json.RawMessage) error {
+		handled.Add(1)
+		return nil
+	})
+
+	values := map[string]interface{}{fieldType: "count", fieldPayload: "{}"}
+	for i := 0; i < 7; i++ {
+		client.deliver("crashed", time.Hour, 1, values)
+	}
+	busy := client.deliver("busy", time.Second, 1, values)
+	exhausted := client.deliver("crashed", time.Hour, 2, values)
+
+	// all the pages are claimed
+	q.claimIdle()
+	require.Eventually(t, func() bool { return handled.Load() == 7 }, time.Second, time.Millisecond)
+
+	count, ok := client.pendingCount(busy)
+	require.True(t, ok)
+	require.EqualValues(t, 1, count)
+
+	_, ok = client.pendingCount(exhausted)
+	require.False(t, ok)
+
+	dead := client.stream("tasks:dead")
+	require.Len(t, dead, 1)
+	require.Equal(t, exhausted, dead[0].Values[fieldID])
+	require.Equal(t, "max deliveries exceeded", dead[0].Values[fieldError])
+
+	require.Equal(t, "1-1", nextID("1-0"))
+	require.Equal(t, "2-0", nextID("1-18446744073709551615"))
+}
+
+func TestDeadLetter(t *testing.T) {
+	q, client := newTestQueue(t, Config{MaxDeliveries: 3})
+
+	errBoom := errors.New("boom")
+	q.Register("fail", func(ctx context.Context, payload json.RawMessage) error {
+		return errBoom
+	})
+	q.Register("bad", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errBoom)
+	})
+
+	deliver := func(taskType string, deliveries int64) redis.XMessage {
+		values := map[string]interface{}{fieldType: taskType, fieldPayload: "{}"}
+		id := client.deliver(q.conf.Consumer, 0, deliveries, values)
+		return redis.XMessage{ID: id, Values: values}
+	}
+
+	// delivered again later
+	msg := deliver("fail", 1)
+	require.Equal(t, errBoom, q.handle(context.Background(), msg, 1))
+	_, ok := client.pendingCount(msg.ID)
+	require.True(t, ok)
+	require.Empty(t, client.stream("tasks:dead"))
+
+	// exhausted, permanent and unknown
+	msgs := []redis.XMessage{deliver("fail", 3), deliver("bad", 1), deliver("unknown", 1)}
+	require.Equal(t, errBoom, q.handle(context.Background(), msgs[0], 3))
+	require.Error(t, q.handle(context.Background(), msgs[1], 1))
+	require.NoError(t, q.handle(context.Background(), msgs[2], 1))
+
+	dead := client.stream("tasks:dead")
+	require.Len(t, dead, 3)
+	for i, msg := range msgs {
+		_, ok := client.pendingCount(msg.ID)
+		require.False(t, ok)
+		require.Equal(t, msg.ID, dead[i].Values[fieldID])
+		require.Equal(t, msg.Values[fieldType], dead[i].Values[fieldType])
+	}
+	require.Equal(t, "boom", dead[1].Values[fieldError])
+	require.Equal(t, "unknown task type: unknown", dead[2].Values[fieldError])
+}
+
+func TestKeepClaim(t *testing.T) {
+	q, client := newTestQueue(t, Config{VisibilityTimeout: 60 * time.Millisecond})
+
+	values := map[string]interface{}{fieldType: "slow", fieldPayload: "{}"}
+	id := client.deliver(q.conf.Consumer, 0, 1, values)
+
+	q.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		deadline := time.Now().Add(200 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			pending, _ := client.XPendingExt(&redis.XPendingExtArgs{Start: id, End: id, Count: 1})
+			require.Len(t, pending, 1)
+			require.Less(t, pending[0].Idle, q.conf.VisibilityTimeout, "should not be claimed by others")
+			require.EqualValues(t, 1, pending[0].RetryCount)
+			time.Sleep(5 * time.Millisecond)
+		}
+		return nil
+	})
+
+	require.NoError(t, q.handle(context.Background(), redis.XMessage{ID: id, Values: values}, 1))
+	_, ok := client.pendingCount(id)
+	require.False(t, ok)
+}
+
+func TestKeepClaimLost(t *testing.T) {
+	q, client := newTestQueue(t, Config{VisibilityTimeout: 60 * time.Millisecond})
+
+	values := map[string]interface{}{fieldType: "slow", fieldPayload: "{}"}
+	id := client.deliver(q.conf.Consumer, 0, 1, values)
+
+	q.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		// claimed by others, e.g. the claim was not extended in time, and kept by them
+		for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+			client.claim(&redis.XClaimArgs{Stream: "tasks", Consumer: "other", Messages: []string{id}}, true)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		pending, _ := client.XPendingExt(&redis.XPendingExtArgs{Start: id, End: id, Count: 1})
+		require.Len(t, pending, 1)
+		require.Equal(t, "other", pending[0].Consumer, "should not be claimed back")
+		return errors.New("boom")
+	})
+
+	require.Error(t, q.handle(context.Background(), redis.XMessage{ID: id, Values: values}, 1))
+}
@@ -0,0 +1,151 @@
+package timerengine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AfterFunc call f after d like time.AfterFunc, but on a wheel timer, and the timer is cancelled
+// when ctx is done before it fires. It is cheap for a large number of short-lived timers, e.g. the
+// per-request timeouts, as it costs neither a runtime timer nor a goroutine while waiting.
+// ctx.Err() is returned if ctx is already done, and ErrStopped if the engine is stopped.
+func (te *TimerEngine) AfterFunc(ctx context.Context, d time.Duration, f func(), opts ...TimerOption) (*TimerTask, error) {
+	return te.afterFunc(ctx, te.clock.Now().Add(d), f, opts)
+}
+
+func (te *TimerEngine) afterFunc(ctx context.Context, t time.Time, f func(), opts []TimerOption) (*TimerTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timerTask := te.newTimerTask(nil, opts)
+	stop := context.AfterFunc(ctx, func() { timerTask.Cancel() })
+	timerTask.task = TaskFunc(func() {
+		stop()
+		f()
+	})
+
+	if !timerTask.arm(t) {
+		stop()
+		return nil, ErrStopped
+	}
+
+	// ctx may be done before the timer is armed, the cancellation above is lost then
+	if ctx.Err() != nil {
+		timerTask.Cancel()
+	}
+	return timerTask, nil
+}
+
+// WithDeadlineCallback return a copy of parent like context.WithDeadline, but the deadline is
+// enforced by a wheel timer, and f is called when the deadline is exceeded, not when the context
+// is cancelled otherwise. f can be nil. Like context.WithDeadline, the context and its children
+// report context.DeadlineExceeded once the deadline is exceeded. If the engine is stopped, the
+// context is cancelled at once with the cause ErrStopped. The cancel function should be called
+// when the context is no longer used, to release the timer.
+func (te *TimerEngine) WithDeadlineCallback(parent context.Context, deadline time.Time, f func()) (context.Context, context.CancelFunc) {
+	cause, cancelCause := context.WithCancelCause(context.Background())
+	ctx := &deadlineCtx{
+		parent:      parent,
+		deadline:    deadline,
+		cause:       cause,
+		cancelCause: cancelCause,
+		done:        make(chan struct{}),
+	}
+
+	if d, ok := parent.Deadline(); ok && d.Before(deadline) {
+		ctx.deadline = d
+	}
+
+	if err := parent.Err(); err != nil {
+		ctx.cancel(err, context.Cause(parent))
+		return ctx, func() {}
+	}
+	// parent may be done right after the check above, and the callback races with the assignment
+	ctx.mu.Lock()
+	ctx.stop = context.AfterFunc(parent, func() {
+		ctx.cancel(parent.Err(), context.Cause(parent))
+	})
+	ctx.mu.Unlock()
+
+	_, err := te.afterFunc(ctx, deadline, func() {
+		if ctx.cancel(context.DeadlineExceeded, context.DeadlineExceeded) && f != nil {
+			f()
+		}
+	}, nil)
+	if err != nil {
+		// a no-op if parent is done
+		ctx.cancel(context.Canceled, err)
+	}
+
+	return ctx, func() { ctx.cancel(context.Canceled, context.Canceled) }
+}
+
+// WithTimeoutCallback is WithDeadlineCallback(parent, now.Add(timeout), f)
+func (te *TimerEngine) WithTimeoutCallback(parent context.Context, timeout time.Duration, f func()) (context.Context, context.CancelFunc) {
+	return te.WithDeadlineCallback(parent, te.clock.Now().Add(timeout), f)
+}
+
+// deadlineCtx is a context done when the deadline enforced by the timer engine is exceeded, when
+// it is cancelled, or when parent is done.
+//
+// It does not embed a cancel context, as the children of a cancel context copy its error, which is
+// always context.Canceled for context.WithCancelCause. Instead, cause is cancelled with the cause
+// right before done is closed, it is found by context.Cause, and notifies the children by AfterFunc.
+type deadlineCtx struct {
+	parent      context.Context
+	deadline    time.Time
+	cause       context.Context
+	cancelCause context.CancelCauseFunc
+	mu          sync.Mutex
+	stop        func() bool
+	done        chan struct{}
+	err         error
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *deadlineCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *deadlineCtx) Value(key interface{}) interface{} {
+	// the cancel context of cause is looked up by context.Cause
+	if v := c.cause.Value(key); v != nil {
+		return v
+	}
+	return c.parent.Value(key)
+}
+
+// AfterFunc lets the children register for the cancellation without a goroutine, see context.AfterFunc
+func (c *deadlineCtx) AfterFunc(f func()) func() bool {
+	return context.AfterFunc(c.cause, f)
+}
+
+// cancel close done with err and cause, return false if it is already done
+func (c *deadlineCtx) cancel(err, cause error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return false
+	}
+
+	c.err = err
+	c.cancelCause(cause)
+	close(c.done)
+
+	if c.stop != nil {
+		c.stop()
+	}
+	return true
+}
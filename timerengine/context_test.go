@@ -0,0 +1,164 @@
+package timerengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestAfterFunc(t *testing.T) {
+	te := newTestEngine(t)
+
+	fired := make(chan struct{})
+	_, err := te.AfterFunc(context.Background(), 5*time.Millisecond, func() { close(fired) })
+	require.NoError(t, err)
+	<-fired
+	require.Equal(t, 0, te.Pending())
+
+	// cancelled with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	timer, err := te.AfterFunc(ctx, time.Hour, func() { t.Error("should not fire") })
+	require.NoError(t, err)
+	require.Equal(t, 1, te.Pending())
+
+	cancel()
+	require.Eventually(t, func() bool { return te.Pending() == 0 }, time.Second, time.Millisecond)
+	require.False(t, timer.pending())
+
+	_, err = te.AfterFunc(ctx, time.Hour, func() {})
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestAfterFuncStopped(t *testing.T) {
+	te := New("test", 1, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+	te.Stop()
+
+	_, err := te.AfterFunc(context.Background(), time.Millisecond, func() {})
+	require.Equal(t, ErrStopped, err)
+
+	ctx, cancel := te.WithTimeoutCallback(context.Background(), time.Hour, nil)
+	defer cancel()
+	require.Equal(t, context.Canceled, ctx.Err())
+	require.Equal(t, ErrStopped, context.Cause(ctx))
+}
+
+func TestWithDeadlineCallback(t *testing.T) {
+	te := newTestEngine(t)
+
+	expired := make(chan struct{})
+	deadline := time.Now().Add(5 * time.Millisecond)
+	ctx, cancel := te.WithDeadlineCallback(context.Background(), deadline, func() { close(expired) })
+	defer cancel()
+
+	// created before the deadline
+	child, childCancel := context.WithCancel(ctx)
+	defer childCancel()
+	value := context.WithValue(ctx, ctxKey{}, "v")
+
+	d, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.Equal(t, deadline, d)
+
+	<-expired
+	<-ctx.Done()
+	require.Equal(t, context.DeadlineExceeded, ctx.Err())
+	require.Equal(t, context.DeadlineExceeded, context.Cause(ctx))
+
+	// the derived contexts see the deadline too
+	<-child.Done()
+	require.Equal(t, context.DeadlineExceeded, child.Err())
+	require.Equal(t, context.DeadlineExceeded, context.Cause(child))
+	require.Equal(t, context.DeadlineExceeded, value.Err())
+	require.Equal(t, "v", value.Value(ctxKey{}))
+
+	late, lateCancel := context.WithCancel(ctx)
+	defer lateCancel()
+	require.Equal(t, context.DeadlineExceeded, late.Err())
+}
+
+type ctxKey struct{}
+
+func TestWithDeadlineCallbackParent(t *testing.T) {
+	te := newTestEngine(t)
+
+	errBoom := errors.New("boom")
+	parent, parentCancel := context.WithCancelCause(context.WithValue(context.Background(), ctxKey{}, "v"))
+	ctx, cancel := te.WithTimeoutCallback(parent, time.Hour, func() { t.Error("should not be called") })
+	defer cancel()
+	child, childCancel := context.WithCancel(ctx)
+	defer childCancel()
+	require.Equal(t, "v", child.Value(ctxKey{}))
+
+	parentCancel(errBoom)
+	<-child.Done()
+	require.Equal(t, context.Canceled, ctx.Err())
+	require.Equal(t, errBoom, context.Cause(ctx))
+	require.Equal(t, errBoom, context.Cause(child))
+	require.Eventually(t, func() bool { return te.Pending() == 0 }, time.Second, time.Millisecond)
+
+	// parent done already
+	ctx, cancel = te.WithTimeoutCallback(parent, time.Hour, nil)
+	defer cancel()
+	require.Equal(t, context.Canceled, ctx.Err())
+	require.Equal(t, errBoom, context.Cause(ctx))
+	require.Equal(t, 0, te.Pending())
+}
+
+// lateErrCtx is a done context reporting no error on the first check, like a context cancelled
+// right after it is checked
+type lateErrCtx struct {
+	context.Context
+	checked atomic.Bool
+}
+
+func (c *lateErrCtx) Err() error {
+	if !c.checked.Swap(true) {
+		return nil
+	}
+	return c.Context.Err()
+}
+
+func TestWithDeadlineCallbackParentRace(t *testing.T) {
+	te := newTestEngine(t)
+
+	done, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := te.WithTimeoutCallback(&lateErrCtx{Context: done}, time.Hour, nil)
+		<-ctx.Done()
+		require.Equal(t, context.Canceled, ctx.Err())
+		cancel()
+	}
+	require.Eventually(t, func() bool { return te.Pending() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestWithDeadlineCallbackCancel(t *testing.T) {
+	te := newTestEngine(t)
+
+	ctx, cancel := te.WithTimeoutCallback(context.Background(), time.Hour, func() { t.Error("should not be called") })
+	child, childCancel := context.WithCancel(ctx)
+	defer childCancel()
+	require.Equal(t, 1, te.Pending())
+
+	cancel()
+	<-child.Done()
+	require.Equal(t, context.Canceled, ctx.Err())
+	require.Eventually(t, func() bool { return te.Pending() == 0 }, time.Second, time.Millisecond)
+
+	// the earlier deadline of parent is kept
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer parentCancel()
+	ctx, cancel = te.WithTimeoutCallback(parent, time.Hour, nil)
+	defer cancel()
+
+	d, _ := ctx.Deadline()
+	pd, _ := parent.Deadline()
+	require.Equal(t, pd, d)
+}
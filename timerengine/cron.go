@@ -0,0 +1,239 @@
+package timerengine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	loc                                   *time.Location
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondField = cronField{min: 0, max: 59}
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// ParseCron parse a cron expression in the time zone loc, nil loc means time.Local.
+//
+// The expression has 5 fields `minute hour day-of-month month day-of-week`, or 6 fields with a
+// leading `second`. A field is `*`, `?`, a value, a range `a-b`, a step `*/n` or `a-b/n`, or a comma
+// separated list of them, months and weekdays also accept names like `JAN` and `MON`, and Sunday is 0 or 7.
+// The macros `@yearly`, `@monthly`, `@weekly`, `@daily` and `@hourly` are supported, and a
+// `CRON_TZ=Asia/Shanghai ` or `TZ=...` prefix overrides loc. Like the standard cron, if both
+// day-of-month and day-of-week are restricted, a day matching either of them fires.
+func ParseCron(expr string, loc *time.Location) (*CronSchedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		i := strings.IndexByte(expr, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid cron expression: %q", expr)
+		}
+
+		var err error
+		if loc, err = time.LoadLocation(expr[strings.IndexByte(expr, '=')+1 : i]); err != nil {
+			return nil, fmt.Errorf("invalid cron time zone: %w", err)
+		}
+		expr = strings.TrimSpace(expr[i:])
+	}
+
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression: %q, expect 5 or 6 fields", expr)
+	}
+
+	var (
+		s      = &CronSchedule{loc: loc}
+		err    error
+		parsed = []struct {
+			bits  *uint64
+			field cronField
+		}{
+			{&s.second, secondField},
+			{&s.minute, minuteField},
+			{&s.hour, hourField},
+			{&s.dom, domField},
+			{&s.month, monthField},
+			{&s.dow, dowField},
+		}
+	)
+
+	for i, p := range parsed {
+		if *p.bits, err = p.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %q: %w", expr, err)
+		}
+	}
+
+	// 7 is also Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// starBit marks a field which is `*` or `?`
+const starBit = 1 << 63
+
+func (f cronField) parse(expr string) (uint64, error) {
+	var result uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		var (
+			rangeExpr = part
+			step      = 1
+			lo, hi    int
+			err       error
+		)
+
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rangeExpr = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: %q", part)
+			}
+		}
+
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			lo, hi = f.min, f.max
+			if f.max == 7 {
+				// day-of-week, avoid matching Sunday twice
+				hi = 6
+			}
+			if step == 1 {
+				result |= starBit
+			}
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			if lo, err = f.value(rangeExpr); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if step > 1 {
+				hi = f.max
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range: %q", part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			result |= 1 << uint(v)
+		}
+	}
+	return result, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range [%d, %d]", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Location return the time zone of the schedule
+func (s *CronSchedule) Location() *time.Location {
+	return s.loc
+}
+
+// Next return the first fire time after t, or zero time if there is none in 5 years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.loc).Add(time.Second - time.Duration(t.Nanosecond())).Truncate(time.Second)
+	limit := t.AddDate(5, 0, 0)
+
+	// move to the next matching field from the biggest to the smallest, restart when a field wraps
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+
+		return t.In(origLoc)
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	var (
+		domMatch = s.dom&(1<<uint(t.Day())) != 0
+		dowMatch = s.dow&(1<<uint(t.Weekday())) != 0
+	)
+
+	if s.dom&starBit != 0 || s.dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,68 @@
+package timerengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/k81/kate/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * FOO *",
+		"TZ=Nowhere/City * * * * *",
+	} {
+		_, err := ParseCron(expr, nil)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc := utils.TimeLocationOfUTCOffset(8)
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+		require.NoError(t, err)
+		return tm
+	}
+
+	cases := []struct {
+		expr string
+		from string
+		next []string
+	}{
+		{"*/15 * * * *", "2024-01-01 10:07:30", []string{"2024-01-01 10:15:00", "2024-01-01 10:30:00"}},
+		{"30 */20 9-10 * * *", "2024-01-01 10:59:00", []string{"2024-01-02 09:00:30", "2024-01-02 09:20:30"}},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", []string{"2028-02-29 00:00:00"}},
+		{"0 9 * * MON-FRI", "2024-01-05 09:00:00", []string{"2024-01-08 09:00:00", "2024-01-09 09:00:00"}},
+		{"0 0 1 * 0", "2024-01-01 00:00:00", []string{"2024-01-07 00:00:00", "2024-01-14 00:00:00"}},
+		{"0 0 * * 7", "2024-01-01 00:00:00", []string{"2024-01-07 00:00:00"}},
+		{"@monthly", "2024-01-15 00:00:00", []string{"2024-02-01 00:00:00", "2024-03-01 00:00:00"}},
+		{"0 12 * JAN,jul *", "2024-02-01 00:00:00", []string{"2024-07-01 12:00:00"}},
+	}
+
+	for _, c := range cases {
+		s, err := ParseCron(c.expr, loc)
+		require.NoError(t, err, c.expr)
+
+		next := at(c.from)
+		for _, want := range c.next {
+			next = s.Next(next)
+			require.Equal(t, at(want), next, c.expr)
+		}
+	}
+
+	s, err := ParseCron("CRON_TZ=UTC 0 0 * * *", loc)
+	require.NoError(t, err)
+	require.Equal(t, at("2024-01-02 08:00:00"), s.Next(at("2024-01-01 08:00:00")))
+
+	s, err = ParseCron("0 0 30 2 *", loc)
+	require.NoError(t, err)
+	require.True(t, s.Next(at("2024-01-01 00:00:00")).IsZero())
+}
@@ -0,0 +1,90 @@
+package timerengine
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type debugTimer struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	FireAt    time.Time `json:"fire_at"`
+	Remaining string    `json:"remaining"`
+}
+
+type debugList struct {
+	Engine  string       `json:"engine"`
+	Tick    string       `json:"tick"`
+	Pending int          `json:"pending"`
+	Timers  []debugTimer `json:"timers"`
+}
+
+type debugCancel struct {
+	Cancelled int `json:"cancelled"`
+}
+
+// DebugHandler returns an http handler to view and cancel the pending timers, e.g. mounted on the
+// profiling server by http.Handle("/debug/timers", te.DebugHandler()).
+//
+//	GET /debug/timers[?tag=t]     list the pending timers as json
+//	DELETE /debug/timers?id=n     cancel the timer of id
+//	DELETE /debug/timers?tag=t    cancel the timers with tag
+func (te *TimerEngine) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch r.Method {
+		case http.MethodGet:
+			infos := te.List(query.Get("tag"))
+			list := debugList{
+				Engine:  te.name,
+				Tick:    te.tick.String(),
+				Pending: te.Pending(),
+				Timers:  make([]debugTimer, 0, len(infos)),
+			}
+			for _, info := range infos {
+				list.Timers = append(list.Timers, debugTimer{
+					ID:        info.ID,
+					Name:      info.Name,
+					Tags:      info.Tags,
+					FireAt:    info.FireAt,
+					Remaining: info.Remaining.Round(te.tick).String(),
+				})
+			}
+			writeDebugJSON(w, list)
+		case http.MethodDelete:
+			var result debugCancel
+			switch {
+			case query.Get("id") != "":
+				id, err := strconv.ParseUint(query.Get("id"), 10, 64)
+				if err != nil {
+					http.Error(w, "invalid timer id", http.StatusBadRequest)
+					return
+				}
+				if te.Cancel(id) {
+					result.Cancelled = 1
+				}
+			case query.Get("tag") != "":
+				result.Cancelled = te.CancelByTag(query.Get("tag"))
+			default:
+				http.Error(w, "id or tag is required", http.StatusBadRequest)
+				return
+			}
+			writeDebugJSON(w, result)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// nolint:errcheck
+	enc.Encode(v)
+}
@@ -0,0 +1,80 @@
+package timerengine
+
+import (
+	"sort"
+	"time"
+)
+
+// TimerInfo describes a pending timer
+type TimerInfo struct {
+	ID        uint64
+	Name      string
+	Tags      []string
+	FireAt    time.Time
+	Remaining time.Duration
+}
+
+// Get return the pending timer of id, false if it is not found, already started or cancelled
+func (te *TimerEngine) Get(id uint64) (*TimerTask, bool) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	timerTask, ok := te.timers[id]
+	return timerTask, ok
+}
+
+// Cancel cancel the pending timer of id, return true if it is cancelled before it starts
+func (te *TimerEngine) Cancel(id uint64) bool {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	timerTask, ok := te.timers[id]
+	if !ok {
+		return false
+	}
+	return timerTask.cancelLocked()
+}
+
+// CancelByTag cancel the pending timers with the tag, return the number of timers cancelled
+func (te *TimerEngine) CancelByTag(tag string) int {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	n := 0
+	for _, timerTask := range te.timers {
+		if timerTask.hasTag(tag) && timerTask.cancelLocked() {
+			n++
+		}
+	}
+	return n
+}
+
+// List return the pending timers ordered by the fire time, only the ones with tag if tag is not empty
+func (te *TimerEngine) List(tag string) []TimerInfo {
+	now := te.clock.Now()
+
+	te.mu.Lock()
+	infos := make([]TimerInfo, 0, len(te.timers))
+	for _, timerTask := range te.timers {
+		if tag != "" && !timerTask.hasTag(tag) {
+			continue
+		}
+
+		infos = append(infos, TimerInfo{
+			ID:        timerTask.ID,
+			Name:      timerTask.name,
+			Tags:      timerTask.tags,
+			FireAt:    timerTask.when,
+			Remaining: timerTask.when.Sub(now),
+		})
+	}
+	te.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].FireAt.Equal(infos[j].FireAt) {
+			return infos[i].FireAt.Before(infos[j].FireAt)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
@@ -0,0 +1,90 @@
+package timerengine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect(t *testing.T) {
+	te := newTestEngine(t)
+	noop := TaskFunc(func() {})
+
+	a, err := te.Schedule(noop, time.Hour, WithName("a"), WithTags("user:1", "mail"))
+	require.NoError(t, err)
+	b, err := te.Schedule(noop, time.Minute, WithName("b"), WithTags("user:1"))
+	require.NoError(t, err)
+	c, err := te.Schedule(noop, 2*time.Minute, WithName("c"), WithTags("user:2"))
+	require.NoError(t, err)
+
+	got, ok := te.Get(a.ID)
+	require.True(t, ok)
+	require.Same(t, a, got)
+	require.Equal(t, "a", got.Name())
+
+	infos := te.List("")
+	require.Len(t, infos, 3)
+	require.Equal(t, []uint64{b.ID, c.ID, a.ID}, []uint64{infos[0].ID, infos[1].ID, infos[2].ID})
+	require.True(t, infos[0].Remaining > 59*time.Second && infos[0].Remaining <= time.Minute)
+	require.Len(t, te.List("mail"), 1)
+
+	require.Equal(t, 2, te.CancelByTag("user:1"))
+	require.Equal(t, 0, te.CancelByTag("user:1"))
+	_, ok = te.Get(a.ID)
+	require.False(t, ok)
+
+	require.True(t, te.Cancel(c.ID))
+	require.False(t, te.Cancel(c.ID))
+	require.Equal(t, 0, te.Pending())
+
+	// fired timers are dropped from the index
+	fired := make(chan struct{})
+	d, err := te.Schedule(TaskFunc(func() { close(fired) }), time.Millisecond)
+	require.NoError(t, err)
+	<-fired
+	_, ok = te.Get(d.ID)
+	require.False(t, ok)
+}
+
+func TestDebugHandler(t *testing.T) {
+	te := newTestEngine(t)
+	noop := TaskFunc(func() {})
+
+	a, err := te.Schedule(noop, time.Hour, WithName("a"), WithTags("x"))
+	require.NoError(t, err)
+	_, err = te.Schedule(noop, time.Hour, WithTags("y"))
+	require.NoError(t, err)
+
+	h := te.DebugHandler()
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/debug/timers?tag=x")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list debugList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Timers, 1)
+	require.Equal(t, a.ID, list.Timers[0].ID)
+	require.Equal(t, "a", list.Timers[0].Name)
+
+	w = serve(http.MethodDelete, "/debug/timers?tag=y")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"cancelled": 1}`, w.Body.String())
+
+	w = serve(http.MethodDelete, "/debug/timers?id=bad")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		w = serve(method, "/debug/timers?tag=x")
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	}
+	require.Equal(t, 1, te.Pending())
+}
@@ -0,0 +1,290 @@
+package timerengine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/k81/kate/utils"
+	"go.uber.org/zap"
+)
+
+// OverlapPolicy defines what happens when a recurring job fires while its last run is not finished
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the fire
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs the job again after the last run finishes
+	OverlapQueue
+	// OverlapConcurrent runs the job concurrently
+	OverlapConcurrent
+)
+
+// String implements the fmt.Stringer interface
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapConcurrent:
+		return "concurrent"
+	}
+	return "unknown"
+}
+
+// JobOption configures a recurring job
+type JobOption func(*Job)
+
+// WithOverlap set the overlap policy of job, default is OverlapSkip
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(j *Job) {
+		j.overlap = policy
+	}
+}
+
+// WithFixedDelay make Every wait interval between the end of a run and the start of the next one,
+// instead of firing at a fixed rate. The runs never overlap with it.
+func WithFixedDelay() JobOption {
+	return func(j *Job) {
+		j.fixedDelay = true
+	}
+}
+
+// WithLocation set the time zone of cron expression, default is time.Local
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *Job) {
+		j.loc = loc
+	}
+}
+
+// WithUTCOffset set the time zone of cron expression by the utc offset in hours
+func WithUTCOffset(utcOffset int) JobOption {
+	return WithLocation(utils.TimeLocationOfUTCOffset(utcOffset))
+}
+
+// Job is a recurring job scheduled by Every or Cron
+type Job struct {
+	te         *TimerEngine
+	task       Task
+	interval   time.Duration
+	cron       *CronSchedule
+	fixedDelay bool
+	overlap    OverlapPolicy
+	loc        *time.Location
+
+	singleton *singleton
+
+	mu      sync.Mutex
+	next    time.Time
+	timer   *TimerTask
+	running int
+	queued  []time.Time
+	stopped bool
+}
+
+// Every run task every interval, at a fixed rate by default, see WithFixedDelay and WithOverlap
+func (te *TimerEngine) Every(interval time.Duration, task Task, opts ...JobOption) *Job {
+	if interval <= 0 {
+		panic(fmt.Sprintf("invalid job interval: %v", interval))
+	}
+
+	j := newJob(te, task, opts)
+	j.interval = interval
+
+	now := te.clock.Now()
+	next := now.Add(interval)
+	if j.singleton != nil {
+		if j.fixedDelay {
+			panic("singleton job can not run with fixed delay")
+		}
+		// the instances agree on the fire times aligned to interval
+		next = now.Truncate(interval).Add(interval)
+	}
+
+	j.start(next)
+	return j
+}
+
+// Cron run task at the times matching the cron expression, see ParseCron for the syntax
+func (te *TimerEngine) Cron(expr string, task Task, opts ...JobOption) (*Job, error) {
+	j := newJob(te, task, opts)
+
+	schedule, err := ParseCron(expr, j.loc)
+	if err != nil {
+		return nil, err
+	}
+	j.cron = schedule
+
+	next := schedule.Next(te.clock.Now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression never fires: %q", expr)
+	}
+	j.start(next)
+	return j, nil
+}
+
+func newJob(te *TimerEngine, task Task, opts []JobOption) *Job {
+	j := &Job{
+		te:   te,
+		task: task,
+	}
+
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+func (j *Job) start(next time.Time) {
+	j.mu.Lock()
+	j.scheduleLocked(next)
+	j.mu.Unlock()
+}
+
+// scheduleLocked set the timer of the next fire, j.mu must be held
+func (j *Job) scheduleLocked(next time.Time) {
+	j.next = next
+	if next.IsZero() {
+		j.timer = nil
+		return
+	}
+
+	var err error
+	if j.timer, err = j.te.ScheduleAt(TaskFunc(func() { j.fire(next) }), next); err != nil {
+		j.te.logger.Warn("schedule job failed", zap.Time("next", next), zap.Error(err))
+	}
+}
+
+// nextAfter return the fire time after the one at scheduled, skipping the ones already missed
+func (j *Job) nextAfter(scheduled, now time.Time) time.Time {
+	if j.cron != nil {
+		if scheduled.Before(now) {
+			scheduled = now
+		}
+		return j.cron.Next(scheduled)
+	}
+
+	next := scheduled.Add(j.interval)
+	if next.Before(now) {
+		next = next.Add(now.Sub(next).Truncate(j.interval) + j.interval)
+	}
+	return next
+}
+
+func (j *Job) fire(scheduled time.Time) {
+	j.mu.Lock()
+
+	if j.stopped {
+		j.mu.Unlock()
+		return
+	}
+
+	if j.fixedDelay {
+		j.next = time.Time{}
+		j.timer = nil
+		j.running++
+		j.mu.Unlock()
+
+		j.run(scheduled)
+		return
+	}
+
+	j.scheduleLocked(j.nextAfter(scheduled, j.te.clock.Now()))
+
+	if j.running > 0 {
+		switch j.overlap {
+		case OverlapSkip:
+			j.mu.Unlock()
+			j.te.logger.Warn("job still running, fire skipped", zap.Time("scheduled", scheduled))
+			return
+		case OverlapQueue:
+			j.queued = append(j.queued, scheduled)
+			j.mu.Unlock()
+			return
+		}
+	}
+
+	j.running++
+	j.mu.Unlock()
+
+	j.run(scheduled)
+}
+
+// run run the task fired at scheduled, and the queued runs after it, j.running is increased by the caller
+func (j *Job) run(scheduled time.Time) {
+	for {
+		if j.singleton != nil {
+			j.singleton.run(j, scheduled)
+		} else {
+			j.runTask()
+		}
+
+		j.mu.Lock()
+		if j.fixedDelay && !j.stopped {
+			j.scheduleLocked(j.te.clock.Now().Add(j.interval))
+		}
+
+		if len(j.queued) > 0 && !j.stopped {
+			scheduled = j.queued[0]
+			j.queued = j.queued[1:]
+			j.mu.Unlock()
+			continue
+		}
+
+		j.running--
+		j.mu.Unlock()
+		return
+	}
+}
+
+func (j *Job) runTask() {
+	defer func() {
+		if r := recover(); r != nil {
+			j.te.logger.Error("job panic", zap.Any("error", r), zap.Stack("stack"))
+		}
+	}()
+
+	j.task.Run()
+}
+
+// Stop stop the job, the running task is not interrupted
+func (j *Job) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.stopped = true
+	j.queued = nil
+	j.next = time.Time{}
+	if j.timer != nil {
+		j.timer.Cancel()
+		j.timer = nil
+	}
+}
+
+// Next return the next fire time, or zero time if the job is stopped or running with fixed delay
+func (j *Job) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.next
+}
+
+// NextN return the next n fire times, assuming the runs finish at once for fixed delay jobs
+func (j *Job) NextN(n int) []time.Time {
+	next := j.Next()
+	if next.IsZero() {
+		return nil
+	}
+
+	times := make([]time.Time, 0, n)
+	for len(times) < n && !next.IsZero() {
+		times = append(times, next)
+		if j.cron != nil {
+			next = j.cron.Next(next)
+		} else {
+			next = next.Add(j.interval)
+		}
+	}
+	return times
+}
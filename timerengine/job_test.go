@@ -0,0 +1,108 @@
+package timerengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func newTestEngine(t *testing.T) *TimerEngine {
+	te := New("test", 4, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+	t.Cleanup(te.Stop)
+	return te
+}
+
+func TestEvery(t *testing.T) {
+	te := newTestEngine(t)
+
+	var runs atomic.Int32
+	job := te.Every(10*time.Millisecond, TaskFunc(func() { runs.Inc() }))
+
+	next := job.NextN(3)
+	require.Len(t, next, 3)
+	require.Equal(t, 10*time.Millisecond, next[1].Sub(next[0]))
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+
+	job.Stop()
+	require.True(t, job.Next().IsZero())
+
+	stopped := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, stopped, runs.Load())
+}
+
+func TestEveryOverlap(t *testing.T) {
+	te := newTestEngine(t)
+
+	for _, c := range []struct {
+		opts        []JobOption
+		concurrency int32
+	}{
+		{[]JobOption{WithOverlap(OverlapSkip)}, 1},
+		{[]JobOption{WithOverlap(OverlapQueue)}, 1},
+		{[]JobOption{WithOverlap(OverlapConcurrent)}, 2},
+		{[]JobOption{WithFixedDelay(), WithOverlap(OverlapConcurrent)}, 1},
+	} {
+		var (
+			running atomic.Int32
+			maxRun  atomic.Int32
+			runs    atomic.Int32
+		)
+
+		job := te.Every(5*time.Millisecond, TaskFunc(func() {
+			if n := running.Inc(); n > maxRun.Load() {
+				maxRun.Store(n)
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Dec()
+			runs.Inc()
+		}), c.opts...)
+
+		require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+		job.Stop()
+
+		if c.concurrency == 1 {
+			require.Equal(t, int32(1), maxRun.Load())
+		} else {
+			require.True(t, maxRun.Load() >= c.concurrency)
+		}
+		require.Eventually(t, func() bool { return running.Load() == 0 }, time.Second, time.Millisecond)
+	}
+}
+
+func TestEveryPastDue(t *testing.T) {
+	te := New("test", 1, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+
+	// the next fire is past due once scheduled, and is fired while the job holds its lock
+	// on the only executor
+	var runs atomic.Int32
+	job := te.Every(time.Nanosecond, TaskFunc(func() { runs.Inc() }))
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+	job.Stop()
+	te.Stop()
+}
+
+func TestCronJob(t *testing.T) {
+	te := newTestEngine(t)
+
+	var runs atomic.Int32
+	job, err := te.Cron("* * * * * *", TaskFunc(func() { runs.Inc() }), WithUTCOffset(8))
+	require.NoError(t, err)
+	defer job.Stop()
+
+	next := job.NextN(2)
+	require.Len(t, next, 2)
+	require.Equal(t, time.Second, next[1].Sub(next[0]))
+
+	require.Eventually(t, func() bool { return runs.Load() >= 1 }, 2*time.Second, 10*time.Millisecond)
+
+	_, err = te.Cron("0 0 30 2 *", TaskFunc(func() {}))
+	require.Error(t, err)
+}
@@ -0,0 +1,32 @@
+package timerengine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/k81/kate/clock"
+)
+
+// DefaultTick is the default tick of timer engine
+const DefaultTick = 10 * time.Millisecond
+
+// Option configures a timer engine
+type Option func(*TimerEngine)
+
+// WithTick set the tick of timer engine, which is the resolution of timers, e.g. time.Millisecond
+func WithTick(tick time.Duration) Option {
+	if tick <= 0 {
+		panic(fmt.Sprintf("invalid timer engine tick: %v", tick))
+	}
+
+	return func(te *TimerEngine) {
+		te.tick = tick
+	}
+}
+
+// WithClock set the clock of timer engine, default is the real clock, e.g. a clock.Fake in tests
+func WithClock(c clock.Clock) Option {
+	return func(te *TimerEngine) {
+		te.clock = c
+	}
+}
@@ -0,0 +1,309 @@
+package timerengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/k81/kate/utils"
+	"go.uber.org/zap"
+)
+
+// ErrNoStore indicates the timer engine has no persistent store, see WithStore
+var ErrNoStore = errors.New("timerengine: no persistent store")
+
+// StoredTimer is a persistent timer
+type StoredTimer struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	FireAt  time.Time       `json:"fire_at"`
+}
+
+// Store persists the timers scheduled by SchedulePersistent
+type Store interface {
+	// Save add or replace a timer
+	Save(timer *StoredTimer) error
+	// Claim move the fire time of timer to until, if it is still timer.FireAt in store, claimed is false otherwise.
+	// A timer fires only on the instance which claims it, so that a store shared by instances fires it once.
+	Claim(timer *StoredTimer, until time.Time) (claimed bool, err error)
+	// Delete remove a timer, deleted is false if it does not exist
+	Delete(id string) (deleted bool, err error)
+	// Load return all the timers
+	Load() ([]*StoredTimer, error)
+	// LoadDue return the timers firing before t
+	LoadDue(t time.Time) ([]*StoredTimer, error)
+}
+
+// PersistentHandler handles the payload of a persistent timer type, the timer fires again later if it
+// returns an error, so it should be idempotent
+type PersistentHandler func(payload json.RawMessage) error
+
+const (
+	// DefaultStorePoll is the default interval of loading the due timers from store
+	DefaultStorePoll = 10 * time.Second
+	// DefaultClaimTimeout is the default time a firing persistent timer is claimed for
+	DefaultClaimTimeout = time.Minute
+)
+
+// MisfirePolicy defines what happens to a persistent timer which was due while the engine was down
+type MisfirePolicy int
+
+const (
+	// MisfireFireNow fires the timer at once
+	MisfireFireNow MisfirePolicy = iota
+	// MisfireDiscard removes the timer without firing
+	MisfireDiscard
+)
+
+// String implements the fmt.Stringer interface
+func (p MisfirePolicy) String() string {
+	switch p {
+	case MisfireFireNow:
+		return "fire_now"
+	case MisfireDiscard:
+		return "discard"
+	}
+	return "unknown"
+}
+
+// WithStore persist the timers scheduled by SchedulePersistent in store, they are reloaded on Start
+func WithStore(store Store) Option {
+	return func(te *TimerEngine) {
+		te.store = store
+	}
+}
+
+// WithStorePoll set the interval of loading the timers due before the next poll from store, so that
+// the timers scheduled by the other instances sharing the store, or left by a crashed one, fire.
+// Default is DefaultStorePoll, and interval <= 0 disables it.
+func WithStorePoll(interval time.Duration) Option {
+	return func(te *TimerEngine) {
+		te.storePoll = interval
+	}
+}
+
+// WithClaimTimeout set the time a firing persistent timer is claimed for, the timer fires again after
+// timeout if its handler fails or the instance crashes. It should be longer than the handlers run,
+// otherwise a timer may fire again while its handler is running. Default is DefaultClaimTimeout.
+func WithClaimTimeout(timeout time.Duration) Option {
+	return func(te *TimerEngine) {
+		te.claimTimeout = timeout
+	}
+}
+
+// WithMisfire set the policy for the timers reloaded later than threshold after their fire time,
+// the ones within threshold always fire, default is MisfireFireNow
+func WithMisfire(policy MisfirePolicy, threshold time.Duration) Option {
+	return func(te *TimerEngine) {
+		te.misfirePolicy = policy
+		te.misfireThreshold = threshold
+	}
+}
+
+// RegisterHandler register the handler of a persistent timer type, it should be called before Start
+func (te *TimerEngine) RegisterHandler(taskType string, h PersistentHandler) {
+	te.persistMu.Lock()
+	te.handlers[taskType] = h
+	te.persistMu.Unlock()
+}
+
+// SchedulePersistent schedule a persistent timer of taskType firing at t, the payload is serialized as json.
+// The timer is claimed before its handler runs and removed from the store after the handler succeeds.
+// It fires at least once: if the handler fails or the instance crashes, it fires again after the claim timeout.
+func (te *TimerEngine) SchedulePersistent(taskType string, payload interface{}, t time.Time) (id string, err error) {
+	if te.store == nil {
+		return "", ErrNoStore
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encode %s payload: %w", taskType, err)
+	}
+
+	timer := &StoredTimer{
+		ID:      utils.FastUUIDStr(),
+		Type:    taskType,
+		Payload: data,
+		FireAt:  t,
+	}
+
+	if err = te.store.Save(timer); err != nil {
+		return "", fmt.Errorf("save timer: %w", err)
+	}
+
+	if err = te.schedulePersistent(timer); err != nil {
+		return "", err
+	}
+	return timer.ID, nil
+}
+
+// CancelPersistent cancel a persistent timer, ok is false if it already fired or does not exist
+func (te *TimerEngine) CancelPersistent(id string) (ok bool, err error) {
+	if te.store == nil {
+		return false, ErrNoStore
+	}
+
+	te.persistMu.Lock()
+	if timerTask, found := te.persistent[id]; found {
+		timerTask.Cancel()
+		delete(te.persistent, id)
+	}
+	te.persistMu.Unlock()
+
+	return te.store.Delete(id)
+}
+
+func (te *TimerEngine) schedulePersistent(timer *StoredTimer) error {
+	// not holding persistMu, as a due timer runs at once and locks it
+	timerTask, err := te.ScheduleAt(TaskFunc(func() { te.firePersistent(timer) }), timer.FireAt)
+	if err != nil {
+		return err
+	}
+
+	te.persistMu.Lock()
+	if timerTask.pending() {
+		te.persistent[timer.ID] = timerTask
+	}
+	te.persistMu.Unlock()
+	return nil
+}
+
+func (te *TimerEngine) firePersistent(timer *StoredTimer) {
+	logger := te.logger.With(zap.String("timer_id", timer.ID), zap.String("type", timer.Type))
+
+	te.persistMu.Lock()
+	delete(te.persistent, timer.ID)
+	h, ok := te.handlers[timer.Type]
+	te.persistMu.Unlock()
+
+	if !ok {
+		// keep it in store, it fires after restarting with the handler registered
+		logger.Error("no handler for persistent timer")
+		return
+	}
+
+	claimed := *timer
+	claimed.FireAt = te.clock.Now().Add(te.claimTimeout)
+
+	ok, err := te.store.Claim(timer, claimed.FireAt)
+	switch {
+	case err != nil:
+		logger.Error("claim persistent timer", zap.Error(err))
+		return
+	case !ok:
+		logger.Debug("persistent timer cancelled or fired by another instance")
+		return
+	}
+
+	if err = h(timer.Payload); err != nil {
+		logger.Error("persistent timer handler failed, fire again later", zap.Time("fire_at", claimed.FireAt), zap.Error(err))
+		if err = te.schedulePersistent(&claimed); err != nil {
+			logger.Error("reschedule persistent timer", zap.Error(err))
+		}
+		return
+	}
+
+	// it fires again after the claim timeout if not deleted
+	if _, err = te.store.Delete(timer.ID); err != nil {
+		logger.Error("delete persistent timer", zap.Error(err))
+	}
+}
+
+// poll schedule the timers due before the next poll periodically
+func (te *TimerEngine) poll() {
+	defer te.wg.Done()
+
+	ticker := te.clock.NewTicker(te.storePoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-te.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		te.loadDue()
+	}
+}
+
+// loadDue schedule the timers due before the next poll, which are not scheduled on this instance,
+// e.g. the ones scheduled by the other instances, or left by a crashed one
+func (te *TimerEngine) loadDue() {
+	timers, err := te.store.LoadDue(te.clock.Now().Add(te.storePoll))
+	if err != nil {
+		te.logger.Error("load due persistent timers", zap.Error(err))
+		return
+	}
+
+	for _, timer := range timers {
+		te.persistMu.Lock()
+		_, scheduled := te.persistent[timer.ID]
+		te.persistMu.Unlock()
+
+		if scheduled {
+			continue
+		}
+
+		if err = te.schedulePersistent(timer); err != nil {
+			te.logger.Error("schedule persistent timer", zap.String("timer_id", timer.ID), zap.Error(err))
+		}
+	}
+}
+
+// reload schedule the timers in store, and handle the misfired ones by the misfire policy
+func (te *TimerEngine) reload() {
+	timers, err := te.store.Load()
+	if err != nil {
+		te.logger.Error("load persistent timers", zap.Error(err))
+		return
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		return timers[i].FireAt.Before(timers[j].FireAt)
+	})
+
+	var (
+		now       = te.clock.Now()
+		discarded int
+	)
+	for _, timer := range timers {
+		if te.misfirePolicy == MisfireDiscard && now.Sub(timer.FireAt) > te.misfireThreshold {
+			if te.discard(timer) {
+				discarded++
+			}
+			continue
+		}
+
+		if err = te.schedulePersistent(timer); err != nil {
+			te.logger.Error("schedule persistent timer", zap.String("timer_id", timer.ID), zap.Error(err))
+		}
+	}
+
+	te.logger.Info("persistent timers reloaded", zap.Int("count", len(timers)), zap.Int("discarded", discarded))
+}
+
+// discard delete the misfired timer, if it is not claimed by another instance since loaded
+func (te *TimerEngine) discard(timer *StoredTimer) bool {
+	logger := te.logger.With(zap.String("timer_id", timer.ID))
+
+	ok, err := te.store.Claim(timer, te.clock.Now().Add(te.claimTimeout))
+	if err != nil {
+		logger.Error("claim misfired timer", zap.Error(err))
+		return false
+	}
+	if !ok {
+		logger.Debug("misfired timer claimed by another instance")
+		return false
+	}
+
+	if _, err = te.store.Delete(timer.ID); err != nil {
+		// fires after the claim timeout
+		logger.Error("delete misfired timer", zap.Error(err))
+		return false
+	}
+	return true
+}
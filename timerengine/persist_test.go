@@ -0,0 +1,328 @@
+package timerengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/k81/kate/rdb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.log")
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Save(&StoredTimer{ID: id, Type: "t", FireAt: time.Now()}))
+	}
+
+	deleted, err := store.Delete("b")
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	deleted, err = store.Delete("b")
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	// claimed once
+	timers, err := store.LoadDue(time.Now())
+	require.NoError(t, err)
+	require.Len(t, timers, 2)
+
+	until := time.Now().Add(time.Hour)
+	claimed, err := store.Claim(timers[0], until)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	claimed, err = store.Claim(timers[0], until)
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	due, err := store.LoadDue(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []*StoredTimer{timers[1]}, due)
+	require.NoError(t, store.Close())
+
+	// a failed delete keeps the timer
+	_, err = store.Delete("a")
+	require.Error(t, err)
+	_, ok := store.timers["a"]
+	require.True(t, ok)
+
+	// a torn record left by crash
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"save","timer":{"id":"d"`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	store, err = NewFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	timers, err = store.Load()
+	require.NoError(t, err)
+
+	var ids []string
+	for _, timer := range timers {
+		ids = append(ids, timer.ID)
+	}
+	require.ElementsMatch(t, []string{"a", "c"}, ids)
+}
+
+func TestPersistentTimer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.log")
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+
+	fired := make(chan string, 4)
+	newEngine := func(opts ...Option) *TimerEngine {
+		te := New("test", 2, zap.NewNop(), append(opts, WithTick(time.Millisecond), WithStore(store))...)
+		te.RegisterHandler("cancel_order", func(payload json.RawMessage) error {
+			var orderID string
+			require.NoError(t, json.Unmarshal(payload, &orderID))
+			fired <- orderID
+			return nil
+		})
+		te.Start()
+		return te
+	}
+
+	te := newEngine()
+	_, err = te.SchedulePersistent("cancel_order", "o1", time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	_, err = te.SchedulePersistent("cancel_order", "o2", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	id, err := te.SchedulePersistent("cancel_order", "o3", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	ok, err := te.CancelPersistent(id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// restart before o1 fires
+	te.Stop()
+	time.Sleep(60 * time.Millisecond)
+
+	te = newEngine()
+	require.Equal(t, "o1", <-fired)
+	te.Stop()
+
+	timers, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, timers, 1)
+
+	// discard the misfired timer
+	require.NoError(t, store.Save(&StoredTimer{ID: "late", Type: "cancel_order", Payload: []byte(`"o4"`), FireAt: time.Now().Add(-time.Minute)}))
+	te = newEngine(WithMisfire(MisfireDiscard, time.Second))
+	defer te.Stop()
+
+	timers, err = store.Load()
+	require.NoError(t, err)
+	require.Len(t, timers, 1)
+	require.Equal(t, 0, len(fired))
+}
+
+func TestPersistentRetry(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "timers.log"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	te := New("test", 2, zap.NewNop(), WithTick(time.Millisecond), WithStore(store), WithClaimTimeout(20*time.Millisecond))
+	var (
+		fired = make(chan time.Time, 2)
+		runs  atomic.Int32
+	)
+	te.RegisterHandler("flaky", func(payload json.RawMessage) error {
+		fired <- time.Now()
+		if runs.Inc() == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	te.Start()
+	defer te.Stop()
+
+	_, err = te.SchedulePersistent("flaky", nil, time.Now())
+	require.NoError(t, err)
+
+	first, second := <-fired, <-fired
+	require.True(t, second.Sub(first) >= 10*time.Millisecond, "fired again after the claim timeout")
+	require.Eventually(t, func() bool {
+		timers, err := store.Load()
+		return err == nil && len(timers) == 0
+	}, time.Second, time.Millisecond)
+}
+
+// claimingStore claims the timers once loaded, like another instance firing them at the same time
+type claimingStore struct {
+	Store
+}
+
+func (s claimingStore) Load() ([]*StoredTimer, error) {
+	timers, err := s.Store.Load()
+	for _, timer := range timers {
+		if _, err := s.Store.Claim(timer, time.Now().Add(time.Minute)); err != nil {
+			return nil, err
+		}
+	}
+	return timers, err
+}
+
+func TestPersistentDiscardClaimed(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "timers.log"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Save(&StoredTimer{ID: "late", Type: "count", FireAt: time.Now().Add(-time.Minute)}))
+
+	te := New("test", 2, zap.NewNop(), WithTick(time.Millisecond), WithStore(claimingStore{store}),
+		WithMisfire(MisfireDiscard, time.Second))
+	te.Start()
+	te.Stop()
+
+	// not discarded, as it is firing on another instance
+	timers, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, timers, 1)
+}
+
+func TestPersistentShared(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "timers.log"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	var (
+		mu    sync.Mutex
+		fired = make(map[string]int)
+		total atomic.Int32
+	)
+	newEngine := func() *TimerEngine {
+		te := New("test", 2, zap.NewNop(), WithTick(time.Millisecond), WithStore(store), WithStorePoll(5*time.Millisecond))
+		te.RegisterHandler("count", func(payload json.RawMessage) error {
+			var id string
+			require.NoError(t, json.Unmarshal(payload, &id))
+
+			mu.Lock()
+			fired[id]++
+			mu.Unlock()
+			total.Inc()
+			return nil
+		})
+		te.Start()
+		return te
+	}
+
+	a, b := newEngine(), newEngine()
+	defer b.Stop()
+
+	ids := []string{"t1", "t2", "t3", "t4", "t5"}
+	for _, id := range ids[:4] {
+		_, err = a.SchedulePersistent("count", id, time.Now().Add(20*time.Millisecond))
+		require.NoError(t, err)
+	}
+	_, err = b.SchedulePersistent("count", "t5", time.Now().Add(20*time.Millisecond))
+	require.NoError(t, err)
+
+	// the timers of a crashed instance fire on the others
+	a.Stop()
+
+	require.Eventually(t, func() bool { return total.Load() == int32(len(ids)) }, time.Second, time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		require.Equal(t, 1, fired[id], id)
+	}
+}
+
+// fakeRedis is an in-memory redis supporting the commands used by RedisStore.Load and LoadDue
+type fakeRedis struct {
+	rdb.Client
+	scores map[string]float64
+	data   map[string]string
+}
+
+func (r *fakeRedis) sorted(max float64) []string {
+	var ids []string
+	for id, score := range r.scores {
+		if score < max {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return r.scores[ids[i]] < r.scores[ids[j]] })
+	return ids
+}
+
+func (r *fakeRedis) ZRange(key string, start, stop int64) *redis.StringSliceCmd {
+	return redis.NewStringSliceResult(r.sorted(1e300), nil)
+}
+
+func (r *fakeRedis) ZRangeByScore(key string, opt redis.ZRangeBy) *redis.StringSliceCmd {
+	var max float64
+	if _, err := fmt.Sscanf(opt.Max, "(%f", &max); err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	return redis.NewStringSliceResult(r.sorted(max), nil)
+}
+
+func (r *fakeRedis) HMGet(key string, fields ...string) *redis.SliceCmd {
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		if data, ok := r.data[field]; ok {
+			values = append(values, data)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return redis.NewSliceResult(values, nil)
+}
+
+func (r *fakeRedis) ZRem(key string, members ...interface{}) *redis.IntCmd {
+	for _, member := range members {
+		delete(r.scores, member.(string))
+	}
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func TestRedisStoreLoad(t *testing.T) {
+	var (
+		now    = time.Now()
+		client = &fakeRedis{scores: make(map[string]float64), data: make(map[string]string)}
+		store  = NewRedisStore(client, "timers")
+	)
+
+	for i, id := range []string{"a", "b", "orphan", "c"} {
+		timer := &StoredTimer{ID: id, Type: "t", FireAt: now.Add(time.Duration(i) * time.Minute)}
+		client.scores[id] = score(timer.FireAt)
+		if id != "orphan" {
+			data, err := json.Marshal(timer)
+			require.NoError(t, err)
+			client.data[id] = string(data)
+		}
+	}
+
+	timers, err := store.LoadDue(now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, timers, 1)
+	require.Equal(t, "a", timers[0].ID)
+
+	// the orphaned id is removed
+	timers, err = store.Load()
+	require.NoError(t, err)
+	require.Len(t, timers, 3)
+	require.NotContains(t, client.scores, "orphan")
+}
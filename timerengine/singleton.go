@@ -0,0 +1,148 @@
+package timerengine
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/k81/kate/clock"
+	"github.com/k81/kate/redsync"
+	"go.uber.org/zap"
+)
+
+// FireRecord records a firing of singleton job run on this instance
+type FireRecord struct {
+	// Job is the name of job
+	Job string
+	// Instance is the instance running the firing
+	Instance string
+	// Scheduled is the fire time
+	Scheduled time.Time
+	// Started and Finished are the time the task starts and finishes
+	Started  time.Time
+	Finished time.Time
+	// LockLost is true if the lock expired while running, so that another instance may also run it
+	LockLost bool
+}
+
+// SingletonConfig defines how a recurring job runs on exactly one instance per fire time
+type SingletonConfig struct {
+	// Name is the unique name of the job across instances, required
+	Name string
+	// Instance identifies this instance in the lock value and records, default is "<hostname>-<pid>"
+	Instance string
+	// Redsync is used to create the locks, default uses the rdb client
+	Redsync *redsync.Redsync
+	// Expiry is the lock expiry, which is extended every Expiry/3 while running, default is 30s.
+	// The lock of a fire time is kept until it expires, so that an instance with a late clock does not run it again.
+	Expiry time.Duration
+	// OnFire is called after the instance runs a firing, optional
+	OnFire func(record FireRecord)
+}
+
+// WithSingleton make the job fire on only one of the instances running it, coordinated by a redsync
+// lock per fire time. The fire times of Every are aligned to the multiples of interval, and the
+// fixed delay is not supported.
+func WithSingleton(conf SingletonConfig) JobOption {
+	if conf.Name == "" {
+		panic("singleton job name is required")
+	}
+	if conf.Instance == "" {
+		hostname, _ := os.Hostname()
+		conf.Instance = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if conf.Expiry <= 0 {
+		conf.Expiry = 30 * time.Second
+	}
+
+	return func(j *Job) {
+		j.singleton = &singleton{conf: conf}
+	}
+}
+
+type singleton struct {
+	conf SingletonConfig
+}
+
+func (s *singleton) newMutex(name string, c clock.Clock) *redsync.Mutex {
+	opts := []redsync.Option{
+		redsync.SetClock(c),
+		redsync.SetExpiry(s.conf.Expiry),
+		redsync.SetTries(1),
+		redsync.SetRetryDelay(time.Millisecond, 2*time.Millisecond),
+		redsync.SetToken(s.conf.Instance),
+	}
+
+	if s.conf.Redsync != nil {
+		return s.conf.Redsync.NewMutex(name, opts...)
+	}
+	return redsync.NewMutex(name, opts...)
+}
+
+// run run the task of j fired at scheduled if this instance wins the lock of the fire time
+func (s *singleton) run(j *Job, scheduled time.Time) {
+	var (
+		name   = fmt.Sprintf("timerengine:singleton:%s:%d", s.conf.Name, scheduled.UnixNano()/int64(time.Millisecond))
+		mutex  = s.newMutex(name, j.te.clock)
+		logger = j.te.logger.With(
+			zap.String("job", s.conf.Name),
+			zap.String("instance", s.conf.Instance),
+			zap.Time("scheduled", scheduled),
+		)
+	)
+
+	if err := mutex.Lock(); err != nil {
+		logger.Debug("singleton job fired on another instance", zap.Error(err))
+		return
+	}
+
+	record := FireRecord{
+		Job:       s.conf.Name,
+		Instance:  s.conf.Instance,
+		Scheduled: scheduled,
+		Started:   j.te.clock.Now(),
+	}
+
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	go s.heartbeat(j.te.clock, mutex, done, lost, logger)
+
+	j.runTask()
+
+	close(done)
+	record.Finished = j.te.clock.Now()
+
+	select {
+	case <-lost:
+		record.LockLost = true
+	default:
+	}
+
+	logger.Info("singleton job fired",
+		zap.Duration("duration", record.Finished.Sub(record.Started)),
+		zap.Bool("lock_lost", record.LockLost),
+	)
+
+	if s.conf.OnFire != nil {
+		s.conf.OnFire(record)
+	}
+}
+
+// heartbeat extend the lock until done, lost is closed if the extension fails
+func (s *singleton) heartbeat(c clock.Clock, mutex *redsync.Mutex, done <-chan struct{}, lost chan<- struct{}, logger *zap.Logger) {
+	ticker := c.NewTicker(s.conf.Expiry / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			if !mutex.Extend() {
+				logger.Warn("singleton job lock lost")
+				close(lost)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package timerengine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k81/kate/redsync"
+	"github.com/k81/kate/redsync/redsynctest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingletonJob(t *testing.T) {
+	var (
+		rs      = redsync.New([]redsync.Pool{redsynctest.NewNode().Pool()})
+		mu      sync.Mutex
+		records []FireRecord
+		runs    = make(map[time.Time]string)
+	)
+
+	for _, instance := range []string{"a", "b", "c"} {
+		te := newTestEngine(t)
+		job := te.Every(20*time.Millisecond, TaskFunc(func() {}), WithSingleton(SingletonConfig{
+			Name:     "job",
+			Instance: instance,
+			Redsync:  rs,
+			OnFire: func(record FireRecord) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				records = append(records, record)
+				if ran, ok := runs[record.Scheduled]; ok {
+					t.Errorf("fire %v ran on both %s and %s", record.Scheduled, ran, record.Instance)
+				}
+				runs[record.Scheduled] = record.Instance
+			},
+		}))
+		defer job.Stop()
+
+		require.Zero(t, job.Next().UnixNano()%int64(20*time.Millisecond))
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(records) >= 5
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, record := range records {
+		require.Equal(t, "job", record.Job)
+		require.False(t, record.LockLost)
+		require.False(t, record.Finished.Before(record.Started))
+	}
+}
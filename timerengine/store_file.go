@@ -0,0 +1,238 @@
+package timerengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const fileStoreCompactMin = 1024
+
+type fileRecord struct {
+	Op    string       `json:"op"`
+	Timer *StoredTimer `json:"timer,omitempty"`
+	ID    string       `json:"id,omitempty"`
+}
+
+// FileStore is a Store in a local append-only file, for a single instance.
+//
+// Every change is appended as a json line and synced to disk, and the file is compacted
+// when it grows to twice the live timers. A torn last line left by a crash is ignored.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	timers  map[string]*StoredTimer
+	records int
+}
+
+// NewFileStore open or create the file store at path
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		timers: make(map[string]*StoredTimer),
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// nolint:errcheck
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var record fileRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		switch {
+		case record.Op == "save" && record.Timer != nil:
+			s.timers[record.Timer.ID] = record.Timer
+		case record.Op == "delete":
+			delete(s.timers, record.ID)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrite the file with the live timers only
+func (s *FileStore) compact() error {
+	tmp := s.path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	for _, timer := range s.timers {
+		if err = writeRecord(w, &fileRecord{Op: "save", Timer: timer}); err != nil {
+			// nolint:errcheck
+			file.Close()
+			return err
+		}
+	}
+
+	if err = w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		// nolint:errcheck
+		s.file.Close()
+	}
+
+	if s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+	s.records = len(s.timers)
+	return nil
+}
+
+func writeRecord(w *bufio.Writer, record *fileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+func (s *FileStore) append(record *fileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write timer store: %w", err)
+	}
+	if err = s.file.Sync(); err != nil {
+		return fmt.Errorf("sync timer store: %w", err)
+	}
+
+	s.records++
+	return nil
+}
+
+// maybeCompact compact the file if it grows too large, it is called after the live timers are updated
+func (s *FileStore) maybeCompact() error {
+	if s.records >= fileStoreCompactMin && s.records > 2*len(s.timers) {
+		return s.compact()
+	}
+	return nil
+}
+
+// Save implements the Store interface
+func (s *FileStore) Save(timer *StoredTimer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(&fileRecord{Op: "save", Timer: timer}); err != nil {
+		return err
+	}
+	s.timers[timer.ID] = timer
+	return s.maybeCompact()
+}
+
+// Delete implements the Store interface
+func (s *FileStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.timers[id]; !ok {
+		return false, nil
+	}
+
+	if err := s.append(&fileRecord{Op: "delete", ID: id}); err != nil {
+		return false, err
+	}
+	delete(s.timers, id)
+	return true, s.maybeCompact()
+}
+
+// Claim implements the Store interface
+func (s *FileStore) Claim(timer *StoredTimer, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.timers[timer.ID]
+	if !ok || !stored.FireAt.Equal(timer.FireAt) {
+		return false, nil
+	}
+
+	claimed := *stored
+	claimed.FireAt = until
+	if err := s.append(&fileRecord{Op: "save", Timer: &claimed}); err != nil {
+		return false, err
+	}
+	s.timers[timer.ID] = &claimed
+	return true, s.maybeCompact()
+}
+
+// Load implements the Store interface
+func (s *FileStore) Load() ([]*StoredTimer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timers := make([]*StoredTimer, 0, len(s.timers))
+	for _, timer := range s.timers {
+		timers = append(timers, timer)
+	}
+	return timers, nil
+}
+
+// LoadDue implements the Store interface
+func (s *FileStore) LoadDue(t time.Time) ([]*StoredTimer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var timers []*StoredTimer
+	for _, timer := range s.timers {
+		if timer.FireAt.Before(t) {
+			timers = append(timers, timer)
+		}
+	}
+	return timers, nil
+}
+
+// Close close the file
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
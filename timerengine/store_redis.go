@@ -0,0 +1,148 @@
+package timerengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/k81/kate/rdb"
+)
+
+// RedisStore is a Store in a redis sorted set of timer ids scored by fire time,
+// and a hash `<key>:data` of the timers, it can be shared by instances.
+// In cluster mode, key should contain a hash tag, e.g. `{order-timers}`, to put both in the same slot.
+type RedisStore struct {
+	client  rdb.Client
+	key     string
+	dataKey string
+}
+
+// NewRedisStore create a redis store using the sorted set key
+func NewRedisStore(client rdb.Client, key string) *RedisStore {
+	return &RedisStore{
+		client:  client,
+		key:     key,
+		dataKey: key + ":data",
+	}
+}
+
+// Save implements the Store interface
+func (s *RedisStore) Save(timer *StoredTimer) error {
+	data, err := json.Marshal(timer)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(s.dataKey, timer.ID, data)
+	pipe.ZAdd(s.key, redis.Z{
+		Score:  score(timer.FireAt),
+		Member: timer.ID,
+	})
+	_, err = pipe.Exec()
+	return err
+}
+
+// score return the score of fire time t in milliseconds
+func score(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
+
+var claimScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[4])
+return 1
+`)
+
+// Claim implements the Store interface, the score compared and set by a script decides the instance claiming it
+func (s *RedisStore) Claim(timer *StoredTimer, until time.Time) (bool, error) {
+	claimed := *timer
+	claimed.FireAt = until
+
+	data, err := json.Marshal(&claimed)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := claimScript.Run(s.client, []string{s.key, s.dataKey},
+		timer.ID, score(timer.FireAt), score(until), data).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Delete implements the Store interface
+func (s *RedisStore) Delete(id string) (bool, error) {
+	pipe := s.client.TxPipeline()
+	removed := pipe.ZRem(s.key, id)
+	pipe.HDel(s.dataKey, id)
+	if _, err := pipe.Exec(); err != nil {
+		return false, err
+	}
+	return removed.Val() > 0, nil
+}
+
+// Load implements the Store interface
+func (s *RedisStore) Load() ([]*StoredTimer, error) {
+	ids, err := s.client.ZRange(s.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.load(ids)
+}
+
+// LoadDue implements the Store interface
+func (s *RedisStore) LoadDue(t time.Time) ([]*StoredTimer, error) {
+	ids, err := s.client.ZRangeByScore(s.key, redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatFloat(score(t), 'f', -1, 64),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.load(ids)
+}
+
+// load return the timers of ids, and remove the orphaned ids without data
+func (s *RedisStore) load(ids []string) ([]*StoredTimer, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	values, err := s.client.HMGet(s.dataKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		timers   = make([]*StoredTimer, 0, len(values))
+		orphaned []interface{}
+	)
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			orphaned = append(orphaned, ids[i])
+			continue
+		}
+
+		timer := &StoredTimer{}
+		if err = json.Unmarshal([]byte(data), timer); err != nil {
+			return nil, fmt.Errorf("decode timer %s: %w", ids[i], err)
+		}
+		timers = append(timers, timer)
+	}
+
+	if len(orphaned) > 0 {
+		if err = s.client.ZRem(s.key, orphaned...).Err(); err != nil {
+			return nil, fmt.Errorf("remove orphaned timers: %w", err)
+		}
+	}
+	return timers, nil
+}
@@ -1,62 +1,77 @@
 package timerengine
 
 import (
-	"container/list"
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/k81/kate/clock"
 	"github.com/k81/kate/taskengine"
 	"go.uber.org/zap"
 )
 
-const (
-	// RingSize define the ring buffer size for timer engine
-	RingSize = 3600
-)
-
-type request struct {
-	task   Task
-	delay  int64
-	result chan *TimerTask
-}
+// ErrStopped indicates the timer engine is already stopped
+var ErrStopped = errors.New("timerengine: engine stopped")
 
-// TimerEngine define the timer engine
+// TimerEngine define the timer engine, which fires timers on a hierarchical timing wheel
 // nolint:maligned
 type TimerEngine struct {
 	name      string
-	buckets   []*list.List
-	requests  chan *request
-	ticker    <-chan time.Time
-	tickIndex uint32
+	tick      time.Duration
+	clock     clock.Clock
+	start     time.Time
+	mu        sync.Mutex
+	wheel     wheel
+	timers    map[uint64]*TimerTask
+	stopped   bool
 	executors *taskengine.TaskEngine
 	taskIDSeq uint64
 	ctx       context.Context
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
 	logger    *zap.Logger
+
+	store            Store
+	storePoll        time.Duration
+	claimTimeout     time.Duration
+	misfirePolicy    MisfirePolicy
+	misfireThreshold time.Duration
+	persistMu        sync.Mutex
+	handlers         map[string]PersistentHandler
+	persistent       map[string]*TimerTask
+
+	// fired holds the expired timers waiting for the dispatcher, guarded by mu
+	fired  []*TimerTask
+	firing chan struct{}
 }
 
-// New create a new TimerEngine
-func New(name string, concurrencyLevel int, logger *zap.Logger) *TimerEngine {
+// New create a new TimerEngine, the timers fire in at most concurrencyLevel tasks at the same time
+func New(name string, concurrencyLevel int, logger *zap.Logger, opts ...Option) *TimerEngine {
 	newctx, cancel := context.WithCancel(context.Background())
 
 	te := &TimerEngine{
-		name:      name,
-		ticker:    time.Tick(time.Second),
-		buckets:   make([]*list.List, RingSize),
-		requests:  make(chan *request, 1024),
-		executors: taskengine.New(newctx, name, concurrencyLevel, logger),
-		ctx:       newctx,
-		cancel:    cancel,
-		logger:    logger.With(zap.String("timerengine", name)),
+		name:         name,
+		tick:         DefaultTick,
+		clock:        clock.New(),
+		timers:       make(map[uint64]*TimerTask),
+		firing:       make(chan struct{}, 1),
+		executors:    taskengine.New(newctx, name, concurrencyLevel, logger),
+		ctx:          newctx,
+		cancel:       cancel,
+		logger:       logger.With(zap.String("timerengine", name)),
+		handlers:     make(map[string]PersistentHandler),
+		persistent:   make(map[string]*TimerTask),
+		storePoll:    DefaultStorePoll,
+		claimTimeout: DefaultClaimTimeout,
 	}
 
-	for i := 0; i < len(te.buckets); i++ {
-		te.buckets[i] = list.New()
+	for _, opt := range opts {
+		opt(te)
 	}
 
+	te.start = te.clock.Now()
 	return te
 }
 
@@ -65,28 +80,59 @@ func (te *TimerEngine) Name() string {
 	return te.name
 }
 
-// Start start the timer engine
+// Tick return the tick of timer engine
+func (te *TimerEngine) Tick() time.Duration {
+	return te.tick
+}
+
+// Start start the timer engine, and reload the persistent timers and poll the due ones if a store is set
 func (te *TimerEngine) Start() {
-	te.wg.Add(1)
+	if te.store != nil {
+		te.reload()
+	}
+
+	te.wg.Add(2)
 	go te.loop()
+	go te.dispatch()
+
+	if te.store != nil && te.storePoll > 0 {
+		te.wg.Add(1)
+		go te.poll()
+	}
 }
 
-// Stop stop the timer engine
+// Stop stop the timer engine, the pending timers are dropped and the running tasks are waited.
+// It is safe to call Stop more than once.
 func (te *TimerEngine) Stop() {
+	te.mu.Lock()
+	te.stopped = true
+	te.mu.Unlock()
+
 	te.cancel()
 	te.wg.Wait()
+
+	// nolint:errcheck
+	te.executors.Shutdown(context.Background())
+}
+
+// Pending return the number of timers waiting to fire
+func (te *TimerEngine) Pending() int {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	return te.wheel.count
 }
 
 func (te *TimerEngine) loop() {
-	te.logger.Info("timer engine loop started")
+	te.logger.Info("timer engine loop started", zap.Duration("tick", te.tick))
+
+	ticker := te.clock.NewTicker(te.tick)
 
 	defer func() {
 		if r := recover(); r != nil {
 			te.logger.Fatal("panic", zap.Any("error", r), zap.Stack("stack"))
 		}
 
-		te.cancel()
-		te.executors.Shutdown()
+		ticker.Stop()
 		te.wg.Done()
 		te.logger.Info("main loop stopped")
 	}()
@@ -95,89 +141,114 @@ func (te *TimerEngine) loop() {
 		select {
 		case <-te.ctx.Done():
 			return
-		case req := <-te.requests:
-			{
-				var (
-					tickIndex   = te.getTickIndex()
-					offset      = int(req.delay) + int(tickIndex)
-					cycleNum    = offset / RingSize
-					bucketIndex = offset % RingSize
-					bucket      = te.buckets[bucketIndex]
-					task        = newTimerTask(te, cycleNum, req.task)
-				)
-				bucket.PushBack(task)
-
-				req.result <- task
+		case <-ticker.C():
+			// the ticks may be dropped for a slow loop, so catch up to now instead of the tick time
+			te.advance(te.ticksAt(te.clock.Now()))
+		}
+	}
+}
+
+// advance fire the timers up to the tick target, catching up the ticks missed by a slow loop
+func (te *TimerEngine) advance(target uint64) {
+	for {
+		te.mu.Lock()
+		if te.wheel.current > target {
+			te.mu.Unlock()
+			return
+		}
+
+		expired := te.wheel.advance()
+		for _, timerTask := range expired {
+			timerTask.state = timerStarted
+			delete(te.timers, timerTask.ID)
+		}
+		te.fired = append(te.fired, expired...)
+		te.mu.Unlock()
+
+		if len(expired) > 0 {
+			select {
+			case te.firing <- struct{}{}:
+			default:
 			}
-		case <-te.ticker:
-			{
-				var (
-					tickIndex = te.updateTickIndex()
-					tasks     = te.buckets[tickIndex]
-				)
-
-				go func(tasks *list.List, tickIndex uint32) {
-					var next *list.Element
-
-					for te := tasks.Front(); te != nil; te = next {
-						next = te.Next()
-						// nolint:errcheck
-						task := te.Value.(*TimerTask)
-
-						if task.ready() {
-							task.dispose()
-							tasks.Remove(te)
-						}
-					}
-				}(tasks, tickIndex)
+		}
+	}
+}
+
+// dispatch hand the expired timers over to the executors, so that the loop keeps ticking
+// while the executors are saturated
+func (te *TimerEngine) dispatch() {
+	defer te.wg.Done()
+
+	for {
+		select {
+		case <-te.ctx.Done():
+			return
+		case <-te.firing:
+		}
+
+		te.mu.Lock()
+		fired := te.fired
+		te.fired = nil
+		te.mu.Unlock()
+
+		for _, timerTask := range fired {
+			if te.ctx.Err() != nil {
+				return
 			}
+			timerTask.dispose()
 		}
 	}
 }
 
-func (te *TimerEngine) nextTaskID() uint64 {
-	return atomic.AddUint64(&te.taskIDSeq, 1)
+// ticksAt return the ticks elapsed from the engine start to t
+func (te *TimerEngine) ticksAt(t time.Time) uint64 {
+	elapsed := t.Sub(te.start)
+	if elapsed < 0 {
+		return 0
+	}
+	return uint64(elapsed / te.tick)
 }
 
-func (te *TimerEngine) updateTickIndex() uint32 {
-	tickIndex := atomic.AddUint32(&te.tickIndex, 1)
-	tickIndex %= RingSize
-	return tickIndex
+func (te *TimerEngine) nextTaskID() uint64 {
+	return atomic.AddUint64(&te.taskIDSeq, 1)
 }
 
-func (te *TimerEngine) getTickIndex() uint32 {
-	tickIndex := atomic.LoadUint32(&te.tickIndex)
-	tickIndex %= RingSize
-	return tickIndex
+func (te *TimerEngine) execute(task Task) {
+	if err := te.executors.Schedule(taskengine.TaskFunc(task.Run)); err != nil {
+		te.logger.Error("schedule timer task failed", zap.Error(err))
+	}
 }
 
-func (te *TimerEngine) execute(f TaskFunc) {
-	te.executors.Schedule(f)
+// Schedule schedule a timer task running after delay, rounded up to the tick,
+// it runs at once if delay <= 0, and ErrStopped is returned if the engine is stopped.
+func (te *TimerEngine) Schedule(task Task, delay time.Duration, opts ...TimerOption) (*TimerTask, error) {
+	return te.ScheduleAt(task, te.clock.Now().Add(delay), opts...)
 }
 
-// Schedule schedule a timer task with delay
-func (te *TimerEngine) Schedule(task Task, delay int64) (timerTask *TimerTask) {
-	if delay <= 0 {
-		timerTask = newTimerTask(te, 0, task)
-		timerTask.dispose()
-		return
+// ScheduleAt schedule a timer task running at t, see Schedule
+func (te *TimerEngine) ScheduleAt(task Task, t time.Time, opts ...TimerOption) (*TimerTask, error) {
+	timerTask := te.newTimerTask(task, opts)
+	if !timerTask.arm(t) {
+		return nil, ErrStopped
 	}
+	return timerTask, nil
+}
 
-	req := &request{
+// newTimerTask create a timer task not put into the wheel yet
+func (te *TimerEngine) newTimerTask(task Task, opts []TimerOption) *TimerTask {
+	timerTask := &TimerTask{
+		ID:     te.nextTaskID(),
 		task:   task,
-		delay:  delay,
-		result: make(chan *TimerTask, 1),
+		engine: te,
 	}
 
-	select {
-	case <-te.ctx.Done():
-		return
-	case te.requests <- req:
+	for _, opt := range opts {
+		opt(timerTask)
 	}
+	return timerTask
+}
 
-	select {
-	case <-te.ctx.Done():
-	case timerTask = <-req.result:
-	}
-	return
+// expiresAt return the tick to fire at t, rounded up so that the timer never fires early
+func (te *TimerEngine) expiresAt(t time.Time) uint64 {
+	return uint64((t.Sub(te.start) + te.tick - 1) / te.tick)
 }
@@ -0,0 +1,186 @@
+package timerengine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k81/kate/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTimerEngine(t *testing.T) {
+	te := New("test", 4, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+	defer te.Stop()
+
+	var (
+		start = time.Now()
+		fired = make(chan time.Duration, 3)
+		task  = TaskFunc(func() { fired <- time.Since(start) })
+	)
+
+	_, err := te.Schedule(task, 20*time.Millisecond)
+	require.NoError(t, err)
+	_, err = te.ScheduleAt(task, start.Add(50*time.Millisecond))
+	require.NoError(t, err)
+	timer, err := te.Schedule(task, 30*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, timer.Cancel())
+
+	require.True(t, (<-fired) >= 20*time.Millisecond)
+	require.True(t, (<-fired) >= 50*time.Millisecond)
+
+	select {
+	case <-fired:
+		t.Fatal("cancelled timer should not fire")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	timer, err = te.Schedule(task, 0)
+	require.NoError(t, err)
+	<-fired
+	require.False(t, timer.Cancel())
+}
+
+func TestFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	te := New("test", 1, zap.NewNop(), WithClock(c))
+	te.Start()
+	defer te.Stop()
+
+	fired := make(chan time.Time, 1)
+	_, err := te.Schedule(TaskFunc(func() { fired <- c.Now() }), time.Minute)
+	require.NoError(t, err)
+
+	// wait for the ticker of loop
+	c.BlockUntil(1)
+	c.Advance(59 * time.Second)
+	require.Eventually(t, func() bool {
+		te.mu.Lock()
+		defer te.mu.Unlock()
+		return te.wheel.current > te.ticksAt(te.start.Add(58*time.Second))
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 1, te.Pending())
+
+	c.Advance(time.Second)
+	require.False(t, (<-fired).Before(te.start.Add(time.Minute)))
+	require.Equal(t, 0, te.Pending())
+}
+
+func TestSaturatedExecutors(t *testing.T) {
+	te := New("test", 1, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+
+	var (
+		release = make(chan struct{})
+		fired   = make(chan int, 3)
+	)
+	_, err := te.Schedule(TaskFunc(func() { <-release }), time.Millisecond)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		i := i
+		_, err = te.Schedule(TaskFunc(func() { fired <- i }), time.Duration(i+2)*time.Millisecond)
+		require.NoError(t, err)
+	}
+
+	// the wheel keeps ticking while the only executor is busy
+	require.Eventually(t, func() bool { return te.Pending() == 0 }, time.Second, time.Millisecond)
+	require.Empty(t, fired)
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, i, <-fired)
+	}
+	te.Stop()
+}
+
+func TestTimerReset(t *testing.T) {
+	te := newTestEngine(t)
+
+	fired := make(chan struct{}, 2)
+	timer, err := te.Schedule(TaskFunc(func() { fired <- struct{}{} }), time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, te.Pending())
+
+	// a pending timer is moved, not duplicated
+	require.True(t, timer.Reset(10*time.Millisecond))
+	require.Equal(t, 1, te.Pending())
+	<-fired
+	require.Equal(t, 0, te.Pending())
+
+	// a fired timer is armed again
+	require.True(t, timer.Reset(time.Millisecond))
+	<-fired
+
+	// so is a cancelled one
+	require.True(t, timer.Reset(time.Hour))
+	require.True(t, timer.Cancel())
+	require.Equal(t, 0, te.Pending())
+	require.True(t, timer.Reset(time.Millisecond))
+	<-fired
+}
+
+func TestStopped(t *testing.T) {
+	te := New("test", 1, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+
+	timer, err := te.Schedule(TaskFunc(func() {}), time.Hour)
+	require.NoError(t, err)
+
+	te.Stop()
+	te.Stop()
+
+	_, err = te.Schedule(TaskFunc(func() {}), time.Millisecond)
+	require.Equal(t, ErrStopped, err)
+	_, err = te.ScheduleAt(TaskFunc(func() {}), time.Now())
+	require.Equal(t, ErrStopped, err)
+	require.False(t, timer.Reset(time.Millisecond))
+}
+
+func TestTimerEngineRace(t *testing.T) {
+	te := New("test", 4, zap.NewNop(), WithTick(time.Millisecond))
+	te.Start()
+
+	var (
+		wg   sync.WaitGroup
+		task = TaskFunc(func() {})
+		errs = make(chan error, 8)
+	)
+
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				timer, err := te.Schedule(task, time.Duration(j%5)*time.Millisecond)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				switch j % 3 {
+				case 0:
+					timer.Cancel()
+				case 1:
+					timer.Reset(time.Duration(i) * time.Millisecond)
+				}
+				te.Pending()
+			}
+		}(i)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	te.Stop()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.Equal(t, ErrStopped, err)
+	}
+
+	_, err := te.Schedule(task, 0)
+	require.Equal(t, ErrStopped, err)
+}
@@ -1,10 +1,6 @@
 package timerengine
 
-import (
-	"sync"
-
-	"go.uber.org/zap"
-)
+import "time"
 
 // Task define the Task interface runned by timer engine
 type Task interface {
@@ -19,77 +15,148 @@ func (f TaskFunc) Run() {
 	f()
 }
 
+type timerState int
+
+const (
+	timerPending timerState = iota
+	timerStarted
+	timerCancelled
+)
+
+// TimerOption configures a timer task
+type TimerOption func(*TimerTask)
+
+// WithName set the name of timer, which is shown when listing the timers
+func WithName(name string) TimerOption {
+	return func(timerTask *TimerTask) {
+		timerTask.name = name
+	}
+}
+
+// WithTags set the tags of timer, see TimerEngine.CancelByTag
+func WithTags(tags ...string) TimerOption {
+	return func(timerTask *TimerTask) {
+		timerTask.tags = append(timerTask.tags, tags...)
+	}
+}
+
 // TimerTask define the timer task
 type TimerTask struct {
-	sync.Mutex
-	ID        uint64
-	task      Task
-	cycleNum  int
-	engine    *TimerEngine
-	started   bool
-	cancelled bool
+	ID     uint64
+	task   Task
+	engine *TimerEngine
+	name   string
+	tags   []string
+	// expires is the tick to fire, the fields below are guarded by engine.mu
+	expires uint64
+	when    time.Time
+	state   timerState
+	bucket  *bucket
+	prev    *TimerTask
+	next    *TimerTask
+}
+
+// Name return the name of timer
+func (timerTask *TimerTask) Name() string {
+	return timerTask.name
 }
 
-func newTimerTask(engine *TimerEngine, cycleNum int, task Task) *TimerTask {
-	taskID := engine.nextTaskID()
+// Tags return the tags of timer
+func (timerTask *TimerTask) Tags() []string {
+	return timerTask.tags
+}
 
-	timerTask := &TimerTask{
-		ID:       taskID,
-		task:     task,
-		cycleNum: cycleNum,
-		engine:   engine,
-	}
-	return timerTask
+// When return the time the timer is set to fire at
+func (timerTask *TimerTask) When() time.Time {
+	timerTask.engine.mu.Lock()
+	defer timerTask.engine.mu.Unlock()
+	return timerTask.when
 }
 
-// Cancel cancel the task
-func (timerTask *TimerTask) Cancel() (ok bool) {
-	timerTask.Lock()
-	if !timerTask.started {
-		timerTask.cancelled = true
+// hasTag return true if the timer has the tag
+func (timerTask *TimerTask) hasTag(tag string) bool {
+	for _, t := range timerTask.tags {
+		if t == tag {
+			return true
+		}
 	}
-	ok = timerTask.cancelled
-	timerTask.Unlock()
-	return
+	return false
 }
 
-func (timerTask *TimerTask) ready() (ready bool) {
-	timerTask.Lock()
+// Cancel cancel the task, return true if the task is cancelled before it starts
+func (timerTask *TimerTask) Cancel() (ok bool) {
+	te := timerTask.engine
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	return timerTask.cancelLocked()
+}
 
-	if timerTask.cancelled {
-		ready = true
-	} else {
-		timerTask.cycleNum--
+// cancelLocked cancel the task, engine.mu must be held
+func (timerTask *TimerTask) cancelLocked() bool {
+	te := timerTask.engine
 
-		if timerTask.cycleNum <= 0 {
-			ready = true
+	if timerTask.state == timerPending {
+		if timerTask.bucket != nil {
+			te.wheel.remove(timerTask)
 		}
+		delete(te.timers, timerTask.ID)
+		timerTask.state = timerCancelled
 	}
-	timerTask.Unlock()
-	return
+	return timerTask.state == timerCancelled
 }
 
-func (timerTask *TimerTask) dispose() {
-	var ok bool
+// Reset reschedule the task to run after delay, even if it already started or was cancelled,
+// false is returned if the engine is stopped
+func (timerTask *TimerTask) Reset(delay time.Duration) bool {
+	return timerTask.arm(timerTask.engine.clock.Now().Add(delay))
+}
 
-	timerTask.Lock()
-	if !timerTask.cancelled {
-		timerTask.started = true
+// arm put the task into the wheel to run at t, or dispatch it at once if t is not after now
+func (timerTask *TimerTask) arm(t time.Time) bool {
+	te := timerTask.engine
+
+	te.mu.Lock()
+	if te.stopped {
+		te.mu.Unlock()
+		return false
 	}
-	ok = timerTask.started
-	timerTask.Unlock()
-
-	if ok {
-		timerTask.engine.execute(func() {
-			defer func() {
-				if r := recover(); r != nil {
-					timerTask.engine.logger.Error("got panic", zap.Any("error", r), zap.Stack("stack"))
-				}
-			}()
-
-			if timerTask.task != nil {
-				timerTask.task.Run()
-			}
-		})
+
+	if timerTask.bucket != nil {
+		te.wheel.remove(timerTask)
 	}
+	timerTask.when = t
+
+	if !t.After(te.clock.Now()) {
+		timerTask.state = timerStarted
+		delete(te.timers, timerTask.ID)
+		// handed over to the dispatcher instead of disposed here, as the caller may hold the locks
+		// the task takes, or run on the only executor
+		te.fired = append(te.fired, timerTask)
+		te.mu.Unlock()
+
+		select {
+		case te.firing <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	timerTask.state = timerPending
+	timerTask.expires = te.expiresAt(t)
+	te.wheel.add(timerTask)
+	te.timers[timerTask.ID] = timerTask
+	te.mu.Unlock()
+	return true
+}
+
+func (timerTask *TimerTask) pending() bool {
+	timerTask.engine.mu.Lock()
+	defer timerTask.engine.mu.Unlock()
+	return timerTask.state == timerPending
+}
+
+func (timerTask *TimerTask) dispose() {
+	timerTask.engine.execute(timerTask.task)
 }
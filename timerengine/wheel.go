@@ -0,0 +1,116 @@
+package timerengine
+
+const (
+	wheelBits   = 8
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 6
+)
+
+// bucket is an intrusive doubly linked list of timers, for O(1) insert and remove
+type bucket struct {
+	head *TimerTask
+}
+
+func (b *bucket) push(t *TimerTask) {
+	t.bucket = b
+	t.prev = nil
+	t.next = b.head
+	if b.head != nil {
+		b.head.prev = t
+	}
+	b.head = t
+}
+
+func (b *bucket) remove(t *TimerTask) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		b.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next, t.bucket = nil, nil, nil
+}
+
+// take detach and return all the timers of the bucket
+func (b *bucket) take() []*TimerTask {
+	var timers []*TimerTask
+	for t := b.head; t != nil; {
+		next := t.next
+		t.prev, t.next, t.bucket = nil, nil, nil
+		timers = append(timers, t)
+		t = next
+	}
+	b.head = nil
+	return timers
+}
+
+// wheel is a hierarchical timing wheel counting in ticks.
+//
+// Level n has wheelSize buckets, each spanning wheelSize^n ticks. A timer is put in the lowest level
+// covering its distance to current, and moved down a level when the bucket of the upper level
+// comes round, so that inserting, removing and advancing cost O(1) regardless of the pending timers.
+// It is not goroutine-safe.
+type wheel struct {
+	// current is the next tick to process
+	current uint64
+	levels  [wheelLevels][wheelSize]bucket
+	count   int
+}
+
+// add put the timer by its expires tick, an expired timer fires at the next tick
+func (w *wheel) add(t *TimerTask) {
+	expires := t.expires
+	if expires < w.current {
+		expires = w.current
+	}
+
+	delta := expires - w.current
+	for level := 0; level < wheelLevels; level++ {
+		if delta < 1<<(wheelBits*(level+1)) {
+			w.levels[level][(expires>>(wheelBits*level))&wheelMask].push(t)
+			w.count++
+			return
+		}
+	}
+
+	// beyond the wheel range, park it at the farthest bucket, it is re-added when cascaded
+	last := wheelLevels - 1
+	w.levels[last][((w.current>>(wheelBits*last))-1)&wheelMask].push(t)
+	w.count++
+}
+
+func (w *wheel) remove(t *TimerTask) {
+	t.bucket.remove(t)
+	w.count--
+}
+
+// advance process the current tick and return the expired timers
+func (w *wheel) advance() []*TimerTask {
+	index := w.current & wheelMask
+
+	// cascade the upper levels when the lower level wraps around
+	for level := 1; index == 0 && level < wheelLevels; level++ {
+		index = (w.current >> (wheelBits * level)) & wheelMask
+		for _, t := range w.levels[level][index].take() {
+			w.count--
+			w.add(t)
+		}
+	}
+
+	var expired []*TimerTask
+	for _, t := range w.levels[0][w.current&wheelMask].take() {
+		w.count--
+		if t.expires > w.current {
+			// parked beyond the wheel range
+			w.add(t)
+			continue
+		}
+		expired = append(expired, t)
+	}
+
+	w.current++
+	return expired
+}
@@ -0,0 +1,95 @@
+package timerengine
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWheel(t *testing.T) {
+	var (
+		w       wheel
+		timers  []*TimerTask
+		expires = []uint64{0, 1, 255, 256, 257, 1000, 65535, 65536, 70000, 1 << 20, 1<<20 + 3}
+	)
+
+	for _, e := range expires {
+		timer := &TimerTask{expires: e}
+		timers = append(timers, timer)
+		w.add(timer)
+	}
+	require.Equal(t, len(expires), w.count)
+
+	cancelled := &TimerTask{expires: 300}
+	w.add(cancelled)
+	w.remove(cancelled)
+
+	fired := make(map[*TimerTask]uint64)
+	for w.current <= 1<<20+3 {
+		tick := w.current
+		for _, timer := range w.advance() {
+			fired[timer] = tick
+		}
+	}
+
+	require.Equal(t, 0, w.count)
+	require.Len(t, fired, len(expires))
+	for _, timer := range timers {
+		require.Equal(t, timer.expires, fired[timer])
+	}
+}
+
+func TestWheelRandom(t *testing.T) {
+	var w wheel
+
+	w.current = 12345
+	pending := make(map[*TimerTask]bool)
+	for i := 0; i < 10000; i++ {
+		timer := &TimerTask{expires: w.current + uint64(rand.Int63n(1<<18))}
+		pending[timer] = true
+		w.add(timer)
+	}
+
+	for len(pending) > 0 {
+		tick := w.current
+		for _, timer := range w.advance() {
+			require.Equal(t, timer.expires, tick)
+			delete(pending, timer)
+		}
+		require.Equal(t, len(pending), w.count)
+	}
+}
+
+// BenchmarkWheelAdd add and remove timers with up to one day delay at 1ms tick,
+// among millions of pending timers
+func BenchmarkWheelAdd(b *testing.B) {
+	var w wheel
+	for i := 0; i < 1000000; i++ {
+		w.add(&TimerTask{expires: uint64(rand.Int63n(86400000))})
+	}
+
+	timers := make([]*TimerTask, b.N)
+	for i := range timers {
+		timers[i] = &TimerTask{expires: uint64(rand.Int63n(86400000))}
+	}
+
+	b.ResetTimer()
+	for _, timer := range timers {
+		w.add(timer)
+		w.remove(timer)
+	}
+}
+
+// BenchmarkWheelAdvance advance the ticks with millions of pending timers, without scanning them
+func BenchmarkWheelAdvance(b *testing.B) {
+	var w wheel
+	for i := 0; i < 1000000; i++ {
+		w.add(&TimerTask{expires: uint64(rand.Int63n(86400000))})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.advance()
+	}
+}